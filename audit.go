@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+const (
+	auditStatusSent   = "sent"
+	auditStatusFailed = "failed"
+)
+
+// auditRecord is a single line of the audit log.
+type auditRecord struct {
+	// When the event was sent (or failed to be).
+	Time   time.Time `json:"time"`
+	Status string    `json:"status"`
+	Sink   string    `json:"sink,omitempty"`
+	Error  string    `json:"error,omitempty"`
+	// The event as sent, in the protobuf JSON mapping.
+	Event json.RawMessage `json:"event"`
+}
+
+// auditLog appends a JSON line to a writer for each outbound event.
+type auditLog struct {
+	clock    Clock
+	failures bool
+	mu       sync.Mutex
+	w        io.Writer
+}
+
+func newAuditLog(clock Clock, w io.Writer, failures bool) *auditLog {
+	return &auditLog{
+		clock:    clock,
+		failures: failures,
+		w:        w,
+	}
+}
+
+// record appends the outcome of sending events to a sink. Failures are only
+// recorded if enabled.
+func (a *auditLog) record(sink string, events []*v1alpha1.TelemetryEvent, sendErr error) error {
+	if sendErr != nil && !a.failures {
+		return nil
+	}
+
+	record := auditRecord{
+		Time:   a.clock.Now().UTC(),
+		Status: auditStatusSent,
+		Sink:   sink,
+	}
+	if sendErr != nil {
+		record.Status = auditStatusFailed
+		record.Error = sendErr.Error()
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, event := range events {
+		data, err := protojson.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to marshal event: %w", err)
+		}
+		record.Event = data
+
+		if err := enc.Encode(&record); err != nil {
+			return fmt.Errorf("failed to encode audit record: %w", err)
+		}
+	}
+
+	// Serialize writes so lines are never interleaved.
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, err := a.w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	// Make sure the record survives a crash, eg. when writing to a file.
+	if s, ok := a.w.(interface{ Sync() error }); ok {
+		if err := s.Sync(); err != nil {
+			return fmt.Errorf("failed to sync audit log: %w", err)
+		}
+	}
+
+	return nil
+}
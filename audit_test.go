@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+type auditRecord struct {
+	Time   time.Time `json:"time"`
+	Status string    `json:"status"`
+	Error  string    `json:"error"`
+	Event  struct {
+		Kind   string `json:"kind"`
+		Name   string `json:"name"`
+		Labels []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"labels"`
+	} `json:"event"`
+}
+
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	t.Run("Sent", func(t *testing.T) {
+		svc := newMockSvc()
+		baseURL := startServer(t, svc)
+
+		var auditLog lockedBuffer
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:            baseURL,
+			AuditLog:           &auditLog,
+			OmitLibraryVersion: true,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		for _, name := range []string{"first", "second"} {
+			r.ReportEvent(&v1alpha1.TelemetryEvent{
+				Kind:   v1alpha1.TelemetryEventKind_WARNING,
+				Name:   name,
+				Labels: []*v1alpha1.Label{{Key: "region", Value: "eu"}},
+			})
+		}
+		require.NoError(t, r.Flush(ctx))
+
+		records := parseAuditLog(t, auditLog.String())
+		require.Len(t, records, 2)
+
+		var names []string
+		for _, record := range records {
+			require.Equal(t, "sent", record.Status)
+			require.False(t, record.Time.IsZero())
+			require.Equal(t, "WARNING", record.Event.Kind)
+			require.Len(t, record.Event.Labels, 1)
+			require.Equal(t, "region", record.Event.Labels[0].Key)
+			names = append(names, record.Event.Name)
+		}
+		require.ElementsMatch(t, []string{"first", "second"}, names)
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		svc := &failingSvc{mockSvc: newMockSvc(), code: connect.CodeInvalidArgument}
+		svc.failures.Store(1)
+		baseURL := startServer(t, svc)
+
+		var auditLog lockedBuffer
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:       baseURL,
+			AuditLog:      &auditLog,
+			AuditFailures: true,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "rejected"})
+		require.NoError(t, r.Flush(ctx))
+
+		records := parseAuditLog(t, auditLog.String())
+		require.Len(t, records, 1)
+		require.Equal(t, "failed", records[0].Status)
+		require.Contains(t, records[0].Error, "injected failure")
+		require.Equal(t, "rejected", records[0].Event.Name)
+	})
+}
+
+func parseAuditLog(t *testing.T, auditLog string) []auditRecord {
+	var records []auditRecord
+	for _, line := range strings.Split(strings.TrimSpace(auditLog), "\n") {
+		if line == "" {
+			continue
+		}
+
+		var record auditRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+
+	return records
+}
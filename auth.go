@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+const (
+	// Tokens are refreshed this long before they expire, to allow for clock
+	// skew and the time taken to send the report.
+	tokenExpiryLeeway = 10 * time.Second
+	// The default number of consecutive authentication failures after which
+	// reporting is disabled.
+	defaultAuthFailureThreshold = 3
+)
+
+// AuthError is passed to the OnError hook when a report is rejected by the
+// telemetry server because of missing or invalid credentials (or
+// insufficient permissions), which indicates a configuration problem.
+type AuthError struct {
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	return "authentication failed: " + e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// isAuthError returns true if the error indicates the report was rejected
+// because of its credentials.
+func isAuthError(err error) bool {
+	var authErr *AuthError
+	if errors.As(err, &authErr) {
+		return true
+	}
+
+	switch connect.CodeOf(err) {
+	case connect.CodeUnauthenticated, connect.CodePermissionDenied:
+		return true
+	default:
+		return false
+	}
+}
+
+// tokenSource caches auth tokens obtained from a callback until they expire.
+type tokenSource struct {
+	clock  Clock
+	fn     func(ctx context.Context) (string, time.Time, error)
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func newTokenSource(clock Clock, fn func(ctx context.Context) (string, time.Time, error)) *tokenSource {
+	return &tokenSource{
+		clock: clock,
+		fn:    fn,
+	}
+}
+
+// get returns a cached token if it's still valid, otherwise it obtains a new
+// one from the callback.
+func (s *tokenSource) get(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && s.clock.Now().Add(tokenExpiryLeeway).Before(s.expiry) {
+		return s.token, nil
+	}
+
+	token, expiry, err := s.fn(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Tokens without an expiry are not cached.
+	s.token, s.expiry = token, expiry
+
+	return token, nil
+}
+
+// invalidate discards the cached token, eg. after it was rejected.
+func (s *tokenSource) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.token, s.expiry = "", time.Time{}
+}
+
+// SetAuthToken replaces the auth bearer token (see Configuration.AuthToken).
+// If reporting was disabled due to repeated authentication failures, it's
+// re-enabled.
+func (r *Reporter) SetAuthToken(token string) {
+	r.authToken.Store(&token)
+
+	if r.authDisabled.Swap(false) {
+		r.authFailures.Store(0)
+		r.logger.Info("Telemetry re-enabled after auth token change")
+	}
+}
+
+// DisabledByAuthFailure returns true if reporting was disabled because the
+// telemetry server repeatedly rejected the reporter's credentials, eg. so the
+// user can be prompted to fix them. Reporting is re-enabled by SetAuthToken or
+// SetEnabled(true).
+func (r *Reporter) DisabledByAuthFailure() bool {
+	return r.authDisabled.Load()
+}
+
+// recordAuthResult tracks consecutive authentication failures, disabling
+// reporting once the threshold is reached.
+func (r *Reporter) recordAuthResult(err error) {
+	if err == nil || !isAuthError(err) {
+		r.authFailures.Store(0)
+		return
+	}
+
+	// The cached token may have been revoked.
+	if r.authTokens != nil {
+		r.authTokens.invalidate()
+	}
+
+	if r.authFailures.Add(1) >= int64(r.maxAuthFailures) && !r.authDisabled.Swap(true) {
+		r.logger.Warn("Telemetry disabled due to repeated authentication failures",
+			slog.Any("error", err))
+		r.discardHeld()
+	}
+}
@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1/v1alpha1connect"
+	"github.com/noisysockets/telemetry/telemetrytest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthTokenFunc(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(svc))
+
+	authHeaders := make(chan string, 10)
+	baseURL := startHTTPServer(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		authHeaders <- req.Header.Get("Authorization")
+		mux.ServeHTTP(w, req)
+	}))
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	t.Run("Cached", func(t *testing.T) {
+		clock := telemetrytest.NewClock(time.Now())
+
+		var calls int
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:   baseURL,
+			AuthToken: "static",
+			AuthTokenFunc: func(ctx context.Context) (string, time.Time, error) {
+				calls++
+				return fmt.Sprintf("token-%d", calls), clock.Now().Add(time.Minute), nil
+			},
+			Clock: clock,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		for i := 0; i < 2; i++ {
+			r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+			require.NoError(t, r.Flush(ctx))
+			require.Equal(t, "Bearer token-1", <-authHeaders)
+		}
+
+		clock.Advance(time.Minute)
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+		require.Equal(t, "Bearer token-2", <-authHeaders)
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		for _, fail := range []bool{false, true} {
+			r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+				BaseURL: baseURL,
+				AuthTokenFunc: func(ctx context.Context) (string, time.Time, error) {
+					return "", time.Time{}, errors.New("injected failure")
+				},
+				FailOnAuthTokenError: fail,
+			})
+			t.Cleanup(func() {
+				require.NoError(t, r.Close())
+			})
+
+			r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+			require.NoError(t, r.Flush(ctx))
+
+			if fail {
+				require.Empty(t, authHeaders)
+				require.Equal(t, uint64(1), r.Stats().FailedSend)
+			} else {
+				require.Empty(t, <-authHeaders)
+				require.Equal(t, uint64(1), r.Stats().DeliveredOK)
+			}
+		}
+	})
+}
+
+func TestAuthFailureThreshold(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &failingSvc{mockSvc: newMockSvc(), code: connect.CodePermissionDenied}
+	svc.failures.Store(2)
+	baseURL := startServer(t, svc)
+
+	errs := make(chan error, 10)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:              baseURL,
+		AuthToken:            "wrong",
+		AuthFailureThreshold: 2,
+		OnError: func(_ *v1alpha1.TelemetryEvent, err error) {
+			errs <- err
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for i := 0; i < 2; i++ {
+		require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+		require.NoError(t, r.Flush(ctx))
+
+		var authErr *telemetry.AuthError
+		require.ErrorAs(t, <-errs, &authErr)
+		require.Equal(t, connect.CodePermissionDenied, connect.CodeOf(authErr))
+	}
+
+	// Reporting is disabled until the credentials are fixed.
+	require.True(t, r.DisabledByAuthFailure())
+	require.False(t, r.Enabled())
+	require.Equal(t, "repeated authentication failures", r.DisabledReason())
+	require.Equal(t, telemetry.StatusDroppedDisabled, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+	require.Equal(t, int32(2), svc.attempts.Load())
+
+	r.SetAuthToken("right")
+	require.False(t, r.DisabledByAuthFailure())
+
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+	require.NoError(t, r.Flush(ctx))
+	require.Len(t, svc.receivedEvents, 1)
+}
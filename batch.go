@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+)
+
+// batcher buffers events and flushes them in batches, once either the batch
+// is full or the batch interval has elapsed.
+type batcher struct {
+	size     int
+	interval time.Duration
+	flush    func(events []*v1alpha1.TelemetryEvent) bool
+	events   chan *v1alpha1.TelemetryEvent
+	flushes  chan chan struct{}
+	stopping chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newBatcher(ctx context.Context, size, maxConcurrentReports int, interval time.Duration, flush func(events []*v1alpha1.TelemetryEvent) bool) *batcher {
+	b := &batcher{
+		size:     size,
+		interval: interval,
+		flush:    flush,
+		// Enough room to fill every in-flight report slot.
+		events:   make(chan *v1alpha1.TelemetryEvent, size*maxConcurrentReports),
+		flushes:  make(chan chan struct{}),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go b.run(ctx)
+
+	return b
+}
+
+// add buffers an event, returning false if the buffer is full.
+func (b *batcher) add(event *v1alpha1.TelemetryEvent) bool {
+	select {
+	case b.events <- event:
+		return true
+	default:
+		return false
+	}
+}
+
+// flushBuffered flushes any buffered events, returning once the batches have
+// been handed off for reporting.
+func (b *batcher) flushBuffered(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case b.flushes <- flushed:
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stop flushes any buffered events and waits for the batcher to exit.
+func (b *batcher) stop() {
+	b.stopOnce.Do(func() {
+		close(b.stopping)
+	})
+
+	<-b.done
+}
+
+func (b *batcher) run(ctx context.Context) {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	batch := make([]*v1alpha1.TelemetryEvent, 0, b.size)
+	flush := func() {
+		if len(batch) > 0 {
+			_ = b.flush(batch)
+			batch = make([]*v1alpha1.TelemetryEvent, 0, b.size)
+		}
+	}
+
+	drain := func() {
+		for {
+			select {
+			case event := <-b.events:
+				batch = append(batch, event)
+				if len(batch) >= b.size {
+					flush()
+				}
+			default:
+				flush()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Aborted, discard any buffered events.
+			return
+		case <-b.stopping:
+			drain()
+			return
+		case flushed := <-b.flushes:
+			drain()
+			close(flushed)
+		case event := <-b.events:
+			batch = append(batch, event)
+			if len(batch) >= b.size {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
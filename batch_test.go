@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchReporting(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	t.Run("Full Batch", func(t *testing.T) {
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:       baseURL,
+			BatchSize:     3,
+			BatchInterval: time.Hour,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		for i := 0; i < 3; i++ {
+			r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		}
+
+		select {
+		case batch := <-svc.receivedBatches:
+			require.Len(t, batch.Events, 3)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for batch")
+		}
+	})
+
+	t.Run("Batch Interval", func(t *testing.T) {
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:       baseURL,
+			BatchSize:     10,
+			BatchInterval: 100 * time.Millisecond,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+		select {
+		case batch := <-svc.receivedBatches:
+			require.Len(t, batch.Events, 2)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for batch")
+		}
+	})
+
+	t.Run("Flush On Shutdown", func(t *testing.T) {
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:       baseURL,
+			BatchSize:     10,
+			BatchInterval: time.Hour,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		t.Cleanup(cancel)
+
+		require.NoError(t, r.Shutdown(ctx))
+
+		ev := <-svc.receivedEvents
+		require.Equal(t, "test", ev.Name)
+	})
+}
+
+func TestFlushInterval(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:       baseURL,
+		BatchSize:     10,
+		BatchInterval: time.Hour,
+		FlushInterval: 100 * time.Millisecond,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	start := time.Now()
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+	// No further events arrive, but the partial batch is still flushed.
+	select {
+	case ev := <-svc.receivedEvents:
+		require.Equal(t, "test", ev.Name)
+		require.Less(t, time.Since(start), 2*time.Second)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Shutdown(ctx))
+}
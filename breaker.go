@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// The default amount of time to stop reporting for once the circuit opens.
+const defaultCooldownPeriod = time.Minute
+
+// circuitBreaker stops reporting after a number of consecutive failures, so we
+// don't waste resources on a server that is down. Once open, a single probe
+// event is let through every cooldown period, if it is delivered successfully
+// the circuit closes again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	logger    *slog.Logger
+	clock     Clock
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	open      bool
+	nextProbe time.Time
+}
+
+func newCircuitBreaker(logger *slog.Logger, clock Clock, threshold int, cooldown time.Duration) *circuitBreaker {
+	if cooldown <= 0 {
+		cooldown = defaultCooldownPeriod
+	}
+
+	return &circuitBreaker{
+		logger:    logger,
+		clock:     clock,
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// allow returns true if an event should be reported.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return true
+	}
+
+	if now := b.clock.Now(); !now.Before(b.nextProbe) {
+		b.nextProbe = now.Add(b.cooldown)
+		return true
+	}
+
+	return false
+}
+
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+
+	if b.open {
+		b.open = false
+		b.logger.Info("Telemetry server reachable again, resuming reporting")
+	}
+}
+
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+
+	if b.open {
+		// The probe failed, wait for another cooldown period.
+		b.nextProbe = b.clock.Now().Add(b.cooldown)
+		return
+	}
+
+	if b.failures >= b.threshold {
+		b.open = true
+		b.nextProbe = b.clock.Now().Add(b.cooldown)
+		b.logger.Info("Telemetry server unreachable, pausing reporting",
+			slog.Int("failures", b.failures), slog.Duration("cooldown", b.cooldown))
+	}
+}
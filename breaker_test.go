@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/telemetrytest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	clock := telemetrytest.NewClock(time.Now())
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:          "http://" + deadAddr(t),
+		FailureThreshold: 2,
+		CooldownPeriod:   time.Minute,
+		Clock:            clock,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	report := func() telemetry.Status {
+		status := r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+		return status
+	}
+
+	// Trip the circuit breaker.
+	require.Equal(t, telemetry.StatusAccepted, report())
+	require.Equal(t, telemetry.StatusAccepted, report())
+
+	require.Equal(t, telemetry.StatusDroppedCircuitOpen, report())
+	require.Equal(t, telemetry.StatusDroppedCircuitOpen, report())
+
+	// A single probe is allowed through after the cooldown.
+	clock.Advance(time.Minute)
+
+	require.Equal(t, telemetry.StatusAccepted, report())
+	require.Equal(t, telemetry.StatusDroppedCircuitOpen, report())
+
+	stats := r.Stats()
+	require.Equal(t, uint64(3), stats.FailedSend)
+	require.Equal(t, uint64(3), stats.DroppedCircuitOpen)
+}
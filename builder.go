@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"fmt"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/proto"
+)
+
+// EventBuilder incrementally constructs a telemetry event, eg.
+//
+//	event, err := telemetry.NewEvent("connect_failed").
+//		WithKind(v1alpha1.TelemetryEventKind_ERROR).
+//		WithTag("linux").
+//		Build()
+//	if err == nil {
+//		reporter.ReportEvent(event)
+//	}
+type EventBuilder struct {
+	event *v1alpha1.TelemetryEvent
+}
+
+// NewEvent starts building an informational event with the given name.
+func NewEvent(name string) *EventBuilder {
+	return &EventBuilder{
+		event: &v1alpha1.TelemetryEvent{
+			Kind: v1alpha1.TelemetryEventKind_INFO,
+			Name: name,
+		},
+	}
+}
+
+// WithKind sets the kind of the event.
+func (b *EventBuilder) WithKind(kind v1alpha1.TelemetryEventKind) *EventBuilder {
+	b.event.Kind = kind
+	return b
+}
+
+// WithPriority sets the priority of the event, see
+// Reporter.ReportEventWithPriority.
+func (b *EventBuilder) WithPriority(priority v1alpha1.TelemetryEventPriority) *EventBuilder {
+	b.event.Priority = priority
+	return b
+}
+
+// WithMessage sets the message associated with the event.
+func (b *EventBuilder) WithMessage(message string) *EventBuilder {
+	b.event.Message = message
+	return b
+}
+
+// WithValue adds a value to the event.
+func (b *EventBuilder) WithValue(key, value string) *EventBuilder {
+	if b.event.Values == nil {
+		b.event.Values = make(map[string]string)
+	}
+	b.event.Values[key] = value
+	return b
+}
+
+// WithTag adds a tag to the event.
+func (b *EventBuilder) WithTag(tag string) *EventBuilder {
+	b.event.Tags = append(b.event.Tags, tag)
+	return b
+}
+
+// WithLabel adds a key/value label to the event.
+func (b *EventBuilder) WithLabel(key, value string) *EventBuilder {
+	b.event.Labels = append(b.event.Labels, &v1alpha1.Label{Key: key, Value: value})
+	return b
+}
+
+// WithSessionID overrides the session id of the event, by default the
+// reporter's current session id is used.
+func (b *EventBuilder) WithSessionID(sessionID string) *EventBuilder {
+	b.event.SessionId = sessionID
+	return b
+}
+
+// Build returns the event, or an error if it's invalid. Each call returns a
+// new event, so the builder can be reused as a template.
+func (b *EventBuilder) Build() (*v1alpha1.TelemetryEvent, error) {
+	if b.event.Name == "" {
+		return nil, fmt.Errorf("%w: missing name", ErrInvalidEvent)
+	}
+
+	if b.event.SessionId != "" && !validSessionID(b.event.SessionId) {
+		return nil, fmt.Errorf("%w: invalid session id", ErrInvalidEvent)
+	}
+
+	if err := ValidateEvent(b.event); err != nil {
+		return nil, err
+	}
+
+	return proto.Clone(b.event).(*v1alpha1.TelemetryEvent), nil
+}
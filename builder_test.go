@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"testing"
+
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestEventBuilder(t *testing.T) {
+	b := telemetry.NewEvent("test").
+		WithKind(v1alpha1.TelemetryEventKind_ERROR).
+		WithMessage("something went wrong").
+		WithValue("foo", "bar").
+		WithTag("linux").
+		WithLabel("region", "eu").
+		WithSessionID("session")
+
+	event, err := b.Build()
+	require.NoError(t, err)
+
+	require.True(t, proto.Equal(&v1alpha1.TelemetryEvent{
+		SessionId: "session",
+		Kind:      v1alpha1.TelemetryEventKind_ERROR,
+		Name:      "test",
+		Message:   "something went wrong",
+		Values:    map[string]string{"foo": "bar"},
+		Tags:      []string{"linux"},
+		Labels:    []*v1alpha1.Label{{Key: "region", Value: "eu"}},
+	}, event))
+
+	// The builder can be reused without affecting previously built events.
+	other, err := b.WithTag("extra").Build()
+	require.NoError(t, err)
+	require.Len(t, event.Tags, 1)
+	require.Len(t, other.Tags, 2)
+
+	_, err = telemetry.NewEvent("").Build()
+	require.ErrorIs(t, err, telemetry.ErrInvalidEvent)
+
+	_, err = telemetry.NewEvent("test").WithSessionID("not valid").Build()
+	require.ErrorIs(t, err, telemetry.ErrInvalidEvent)
+
+	_, err = telemetry.NewEvent("test").WithLabel("", "value").Build()
+	require.ErrorIs(t, err, telemetry.ErrInvalidEvent)
+}
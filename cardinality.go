@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+)
+
+// OverflowLabelValue replaces the values of labels that have exceeded the
+// maximum number of distinct values, see
+// Configuration.MaxDistinctLabelValues.
+const OverflowLabelValue = "__overflow__"
+
+// cardinalityGuard limits the number of distinct values of each label key
+// within a session, protecting the backend from accidental high-cardinality
+// labels (eg. a unique id in a label).
+type cardinalityGuard struct {
+	logger    *slog.Logger
+	max       int
+	mu        sync.Mutex
+	sessionID string
+	values    map[string]map[string]struct{}
+	// Keys that have already been warned about this session.
+	warned map[string]bool
+}
+
+func newCardinalityGuard(logger *slog.Logger, max int) *cardinalityGuard {
+	return &cardinalityGuard{
+		logger: logger,
+		max:    max,
+		values: make(map[string]map[string]struct{}),
+		warned: make(map[string]bool),
+	}
+}
+
+// limit replaces any new label values beyond the maximum for their key with
+// OverflowLabelValue. The distinct values are tracked for the reporter's
+// session, and reset when it rotates.
+func (g *cardinalityGuard) limit(sessionID string, labels []*v1alpha1.Label) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if sessionID != g.sessionID {
+		g.sessionID = sessionID
+		clear(g.values)
+		clear(g.warned)
+	}
+
+	for i, label := range labels {
+		values, ok := g.values[label.Key]
+		if !ok {
+			values = make(map[string]struct{})
+			g.values[label.Key] = values
+		}
+
+		if _, ok := values[label.Value]; ok {
+			continue
+		}
+
+		if len(values) < g.max {
+			values[label.Value] = struct{}{}
+			continue
+		}
+
+		if !g.warned[label.Key] {
+			g.warned[label.Key] = true
+			g.logger.Warn("Too many distinct label values, replacing further values",
+				slog.String("key", label.Key), slog.Int("max", g.max))
+		}
+
+		labels[i] = &v1alpha1.Label{Key: label.Key, Value: OverflowLabelValue}
+	}
+}
@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"os"
+	"strings"
+)
+
+// The environment variables set by common CI providers, keep in sync with the
+// documentation of IsCI.
+var ciEnvVars = []string{
+	"CI",
+	"CONTINUOUS_INTEGRATION",
+	"GITHUB_ACTIONS",
+	"GITLAB_CI",
+	"CIRCLECI",
+	"TRAVIS",
+	"BUILDKITE",
+	"JENKINS_URL",
+	"TF_BUILD",
+	"TEAMCITY_VERSION",
+	"BITBUCKET_BUILD_NUMBER",
+	"CODEBUILD_BUILD_ID",
+	"DRONE",
+	"APPVEYOR",
+}
+
+// IsCI returns true if running in a continuous integration environment, ie.
+// any of the following environment variables are set (to anything other
+// than an empty string, "0", or "false"):
+//
+//   - CI (set by most providers)
+//   - CONTINUOUS_INTEGRATION
+//   - GITHUB_ACTIONS (GitHub Actions)
+//   - GITLAB_CI (GitLab CI/CD)
+//   - CIRCLECI (CircleCI)
+//   - TRAVIS (Travis CI)
+//   - BUILDKITE (Buildkite)
+//   - JENKINS_URL (Jenkins)
+//   - TF_BUILD (Azure Pipelines)
+//   - TEAMCITY_VERSION (TeamCity)
+//   - BITBUCKET_BUILD_NUMBER (Bitbucket Pipelines)
+//   - CODEBUILD_BUILD_ID (AWS CodeBuild)
+//   - DRONE (Drone)
+//   - APPVEYOR (AppVeyor)
+func IsCI() bool {
+	_, ok := ciEnvVar()
+	return ok
+}
+
+// ciEnvVar returns the first CI environment variable that's set.
+func ciEnvVar() (string, bool) {
+	for _, envVar := range ciEnvVars {
+		switch value := strings.ToLower(os.Getenv(envVar)); value {
+		case "", "0", "false":
+		default:
+			return envVar, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultOptOutEnvVar is the default environment variable that, when set,
+	// disables telemetry reporting.
+	DefaultOptOutEnvVar = "NSH_NO_TELEMETRY"
+	// The cross-tool convention for opting out of telemetry.
+	// See: https://consoledonottrack.com/
+	doNotTrackEnvVar = "DO_NOT_TRACK"
+)
+
+// optedOut checks whether the user has opted out of telemetry via the
+// environment. It returns the name of the environment variable responsible.
+func optedOut(optOutEnvVar string) (string, bool) {
+	if optOutEnvVar == "" {
+		optOutEnvVar = DefaultOptOutEnvVar
+	}
+
+	if os.Getenv(optOutEnvVar) != "" {
+		return optOutEnvVar, true
+	}
+
+	if doNotTrack, err := strconv.ParseBool(os.Getenv(doNotTrackEnvVar)); err == nil && doNotTrack {
+		return doNotTrackEnvVar, true
+	}
+
+	return "", false
+}
+
+// readConsentFile reads the user's consent from a file. It returns false for
+// ok if the file doesn't exist, or its contents aren't recognized.
+func readConsentFile(path string) (consent, ok bool, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, false, nil
+		}
+
+		return false, false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(data))) {
+	case "true", "1", "yes", "on", "opt-in":
+		return true, true, nil
+	case "false", "0", "no", "off", "opt-out":
+		return false, true, nil
+	default:
+		return false, false, nil
+	}
+}
+
+// RefreshConsent re-evaluates the user's consent from the consent file (if
+// configured) and the environment, eg. after the user has changed it. It's a
+// no-op once SetEnabled has been called.
+func (r *Reporter) RefreshConsent() {
+	if r.consentOverridden.Load() {
+		return
+	}
+
+	enabled, source := true, ""
+	if r.consentFile != "" {
+		consent, ok, err := readConsentFile(r.consentFile)
+		if err != nil {
+			r.logger.Warn("Failed to read consent file", slog.Any("error", err))
+		}
+
+		if ok {
+			enabled, source = consent, r.consentFile
+		}
+	}
+
+	var reason string
+	if !enabled {
+		reason = "opted out in " + source
+	}
+
+	if source == "" {
+		if envVar, ok := optedOut(r.optOutEnvVar); ok {
+			enabled, source, reason = false, envVar, envVar+" set"
+		}
+	}
+
+	// Bot traffic isn't wanted, whatever the consent.
+	if enabled && r.disableInCI {
+		if envVar, ok := ciEnvVar(); ok {
+			enabled, source, reason = false, envVar, "CI detected"
+		}
+	}
+
+	if !enabled {
+		r.setDisabledReason(reason)
+	}
+
+	if r.enabled.Swap(enabled) != enabled {
+		if enabled {
+			r.logger.Info("Telemetry enabled", slog.String("source", source))
+		} else {
+			r.logger.Info("Telemetry disabled", slog.String("source", source))
+			r.markDisabled()
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptOut(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	report := func(t *testing.T, conf telemetry.Configuration) int {
+		conf.BaseURL = baseURL
+
+		r := telemetry.NewReporter(ctx, logger, conf)
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+
+		n := len(svc.receivedEvents)
+		for len(svc.receivedEvents) > 0 {
+			<-svc.receivedEvents
+		}
+
+		return n
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		t.Setenv(telemetry.DefaultOptOutEnvVar, "1")
+
+		require.Zero(t, report(t, telemetry.Configuration{}))
+	})
+
+	t.Run("Custom", func(t *testing.T) {
+		t.Setenv("MYTOOL_NO_TELEMETRY", "1")
+
+		require.Zero(t, report(t, telemetry.Configuration{
+			OptOutEnvVar: "MYTOOL_NO_TELEMETRY",
+		}))
+	})
+
+	t.Run("Do Not Track", func(t *testing.T) {
+		t.Setenv("DO_NOT_TRACK", "1")
+
+		require.Zero(t, report(t, telemetry.Configuration{}))
+	})
+
+	t.Run("Not Set", func(t *testing.T) {
+		require.Equal(t, 1, report(t, telemetry.Configuration{}))
+	})
+}
+
+func TestSetEnabled(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.True(t, r.Enabled())
+	require.Empty(t, r.DisabledReason())
+
+	r.SetEnabled(false)
+	require.False(t, r.Enabled())
+	require.Equal(t, "disabled by the application", r.DisabledReason())
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "disabled"})
+	require.NoError(t, r.Flush(ctx))
+
+	r.SetEnabled(true)
+	require.True(t, r.Enabled())
+	require.Empty(t, r.DisabledReason())
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "enabled"})
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, svc.receivedEvents, 1)
+	require.Equal(t, "enabled", (<-svc.receivedEvents).Name)
+}
+
+func TestConsentFile(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	consentFile := filepath.Join(t.TempDir(), "consent")
+
+	// The consent file takes precedence over the environment.
+	t.Setenv(telemetry.DefaultOptOutEnvVar, "1")
+	require.NoError(t, os.WriteFile(consentFile, []byte("true\n"), 0o600))
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:     baseURL,
+		ConsentFile: consentFile,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+
+	require.NoError(t, os.WriteFile(consentFile, []byte("opt-out"), 0o600))
+	r.RefreshConsent()
+	require.Equal(t, telemetry.StatusDroppedDisabled, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+	require.Equal(t, "opted out in "+consentFile, r.DisabledReason())
+
+	// Falls back to the environment if the file is missing.
+	require.NoError(t, os.Remove(consentFile))
+	r.RefreshConsent()
+	require.Equal(t, telemetry.StatusDroppedDisabled, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+	require.Equal(t, telemetry.DefaultOptOutEnvVar+" set", r.DisabledReason())
+
+	// Explicitly enabling takes precedence over both.
+	require.NoError(t, os.WriteFile(consentFile, []byte("false"), 0o600))
+	r.SetEnabled(true)
+	r.RefreshConsent()
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+}
+
+func TestDisableInCI(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	// Clear any variables set by the CI running the tests.
+	for _, envVar := range []string{"CI", "CONTINUOUS_INTEGRATION", "GITHUB_ACTIONS", "GITLAB_CI",
+		"CIRCLECI", "TRAVIS", "BUILDKITE", "JENKINS_URL", "TF_BUILD", "TEAMCITY_VERSION",
+		"BITBUCKET_BUILD_NUMBER", "CODEBUILD_BUILD_ID", "DRONE", "APPVEYOR"} {
+		t.Setenv(envVar, "")
+	}
+
+	require.False(t, telemetry.IsCI())
+
+	t.Setenv("CI", "false")
+	require.False(t, telemetry.IsCI())
+
+	t.Setenv("CI", "true")
+	require.True(t, telemetry.IsCI())
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:     baseURL,
+		DisableInCI: true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.False(t, r.Enabled())
+	require.Equal(t, "CI detected", r.DisabledReason())
+	require.Equal(t, telemetry.StatusDroppedDisabled, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+
+	// Enabled again once no longer detected.
+	t.Setenv("CI", "")
+	r.RefreshConsent()
+	require.True(t, r.Enabled())
+}
+
+func TestReportDisabledDrops(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:             baseURL,
+		ReportDisabledDrops: true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.SetEnabled(false)
+	for i := 0; i < 3; i++ {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "secret"})
+	}
+	require.Equal(t, uint64(3), r.Stats().DroppedDisabled)
+
+	r.SetEnabled(true)
+	require.NoError(t, r.Flush(ctx))
+
+	// Only the count is reported, not the events themselves.
+	require.Len(t, svc.receivedEvents, 1)
+	ev := <-svc.receivedEvents
+	require.Equal(t, "telemetry_dropped_while_disabled", ev.Name)
+	require.Equal(t, int64(3), ev.Counter.Value)
+	require.NotNil(t, ev.Counter.StartTime)
+
+	// Nothing more to report the next time around.
+	r.SetEnabled(false)
+	r.SetEnabled(true)
+	require.NoError(t, r.Flush(ctx))
+	require.Empty(t, svc.receivedEvents)
+}
@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The default interval at which aggregated counters are reported.
+const defaultCounterInterval = time.Minute
+
+// counter is the accumulated value of a counter with a given set of labels.
+type counter struct {
+	name   string
+	labels []*v1alpha1.Label
+	value  int64
+}
+
+// counterAggregator accumulates counter increments locally, so that they can
+// be reported periodically as a single event per counter.
+type counterAggregator struct {
+	clock    Clock
+	mu       sync.Mutex
+	started  time.Time
+	counters map[string]*counter
+	stopping chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newCounterAggregator(clock Clock) *counterAggregator {
+	return &counterAggregator{
+		clock:    clock,
+		started:  clock.Now(),
+		counters: make(map[string]*counter),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// add increments the counter with the given name and labels.
+func (a *counterAggregator) add(name string, delta int64, labels map[string]string) {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Counters are keyed by their name and (sorted) labels.
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, key := range keys {
+		sb.WriteByte(0)
+		sb.WriteString(key)
+		sb.WriteByte(0)
+		sb.WriteString(labels[key])
+	}
+	id := sb.String()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	c, ok := a.counters[id]
+	if !ok {
+		c = &counter{name: name}
+		for _, key := range keys {
+			c.labels = append(c.labels, &v1alpha1.Label{Key: key, Value: labels[key]})
+		}
+		a.counters[id] = c
+	}
+
+	c.value += delta
+}
+
+// drain returns an event for each counter incremented since the last drain,
+// and resets the counters.
+func (a *counterAggregator) drain() []*v1alpha1.TelemetryEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	startTime := timestamppb.New(a.started)
+	a.started = a.clock.Now()
+
+	if len(a.counters) == 0 {
+		return nil
+	}
+
+	events := make([]*v1alpha1.TelemetryEvent, 0, len(a.counters))
+	for _, c := range a.counters {
+		events = append(events, &v1alpha1.TelemetryEvent{
+			Kind:   v1alpha1.TelemetryEventKind_INFO,
+			Name:   c.name,
+			Labels: c.labels,
+			Counter: &v1alpha1.Counter{
+				Value:     c.value,
+				StartTime: startTime,
+			},
+		})
+	}
+	clear(a.counters)
+
+	return events
+}
+
+// run calls flush every interval, and once more when stopped. It exits
+// without flushing if ctx is canceled.
+func (a *counterAggregator) run(ctx context.Context, interval time.Duration, flush func()) {
+	defer close(a.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.stopping:
+			flush()
+			return
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// stop reports the counters one last time and waits for the aggregator to
+// exit.
+func (a *counterAggregator) stop() {
+	a.stopOnce.Do(func() {
+		close(a.stopping)
+	})
+
+	<-a.done
+}
+
+// IncrementCounter adds delta to the counter with the given name and labels.
+// Counters are aggregated locally and reported periodically (see
+// Configuration.CounterInterval) as a single event per distinct name and set
+// of labels, with the accumulated value attached. Any outstanding counts are
+// reported on Flush and Shutdown.
+func (r *Reporter) IncrementCounter(name string, delta int64, labels map[string]string) {
+	if !r.Enabled() || r.shuttingDown.Load() {
+		return
+	}
+
+	r.counters.add(name, delta, labels)
+}
+
+// flushCounters reports the accumulated counter values, unless reporting has
+// been disabled in the meantime.
+func (r *Reporter) flushCounters() {
+	events := r.counters.drain()
+	if !r.Enabled() {
+		return
+	}
+
+	for _, event := range events {
+		r.stamp(event)
+		if !r.checkEvent(event) {
+			r.recordStatus(event, StatusDroppedInvalid)
+			continue
+		}
+
+		// Like any other event, counters pass through the interceptors.
+		_ = r.intercept(r.reportsCtx, event, func(ctx context.Context, event *v1alpha1.TelemetryEvent) Status {
+			return r.enqueue(ctx, event, false)
+		})
+	}
+}
@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncrementCounter(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:         baseURL,
+		CounterInterval: time.Hour,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.IncrementCounter("bytes_sent", 10, map[string]string{"peer": "a"})
+	r.IncrementCounter("bytes_sent", 5, map[string]string{"peer": "a"})
+	r.IncrementCounter("bytes_sent", 3, map[string]string{"peer": "b"})
+	r.IncrementCounter("reconnects", 1, nil)
+
+	// Nothing is reported until the counters are flushed.
+	require.Len(t, svc.receivedEvents, 0)
+
+	require.NoError(t, r.Flush(ctx))
+
+	counts := map[string]int64{}
+	for len(svc.receivedEvents) > 0 {
+		ev := <-svc.receivedEvents
+		require.NotNil(t, ev.Counter)
+		require.NotNil(t, ev.Counter.StartTime)
+
+		key := ev.Name
+		for _, label := range ev.Labels {
+			if label.Key == "peer" {
+				key += "/" + label.Value
+			}
+		}
+		counts[key] = ev.Counter.Value
+	}
+
+	require.Equal(t, map[string]int64{
+		"bytes_sent/a": 15,
+		"bytes_sent/b": 3,
+		"reconnects":   1,
+	}, counts)
+
+	// Counters are reset after being reported.
+	r.IncrementCounter("reconnects", 2, nil)
+
+	require.NoError(t, r.Shutdown(ctx))
+
+	require.Len(t, svc.receivedEvents, 1)
+	ev := <-svc.receivedEvents
+	require.Equal(t, "reconnects", ev.Name)
+	require.Equal(t, int64(2), ev.Counter.Value)
+
+	// Increments after shutdown are dropped.
+	r.IncrementCounter("reconnects", 1, nil)
+}
+
+func TestCountersDisabled(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:         baseURL,
+		CounterInterval: time.Hour,
+		RollupWindow:    time.Hour,
+		DedupWindow:     time.Hour,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.IncrementCounter("reconnects", 1, nil)
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "retry"}))
+	require.Equal(t, telemetry.StatusDroppedDuplicate, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "retry"}))
+
+	// Nothing recorded before reporting was disabled is reported afterwards.
+	r.SetEnabled(false)
+	r.IncrementCounter("reconnects", 1, nil)
+	r.SetEnabled(true)
+
+	require.NoError(t, r.Flush(ctx))
+	require.Empty(t, svc.receivedEvents)
+
+	// Invalid counters are dropped.
+	r.IncrementCounter(strings.Repeat("a", telemetry.DefaultMaxEventBytes), 1, nil)
+	require.NoError(t, r.Flush(ctx))
+	require.Empty(t, svc.receivedEvents)
+	require.Equal(t, uint64(1), r.Stats().DroppedInvalid)
+}
+
+func TestCountersInterceptor(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		Interceptors: []telemetry.Interceptor{
+			func(next telemetry.SendFunc) telemetry.SendFunc {
+				return func(ctx context.Context, event *v1alpha1.TelemetryEvent) telemetry.Status {
+					if event.Counter != nil {
+						return telemetry.StatusDroppedIntercepted
+					}
+					return next(ctx, event)
+				}
+			},
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.IncrementCounter("secret", 1, nil)
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	// Only the regular event made it through.
+	require.Len(t, svc.receivedEvents, 1)
+	require.Equal(t, "test", (<-svc.receivedEvents).Name)
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/proto"
+)
+
+// The maximum number of distinct events tracked for deduplication.
+const maxDedupEntries = 1024
+
+// deduplicator suppresses identical events reported within a time window. The
+// number of suppressed events is attached to the next reported occurrence of
+// the event, or reported on flush.
+type deduplicator struct {
+	mu      sync.Mutex
+	clock   Clock
+	window  time.Duration
+	entries map[[sha256.Size]byte]*list.Element
+	// Least recently seen entries are at the back.
+	lru *list.List
+}
+
+type dedupEntry struct {
+	hash       [sha256.Size]byte
+	event      *v1alpha1.TelemetryEvent
+	lastSent   time.Time
+	suppressed int64
+}
+
+func newDeduplicator(clock Clock, window time.Duration) *deduplicator {
+	return &deduplicator{
+		clock:   clock,
+		window:  window,
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// suppress returns true if the event is a duplicate of one reported within the
+// window. Otherwise, the number of duplicates suppressed since the event was
+// last reported is attached to it.
+func (d *deduplicator) suppress(event *v1alpha1.TelemetryEvent) bool {
+	hash := hashEvent(event)
+	now := d.clock.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if elem, ok := d.entries[hash]; ok {
+		d.lru.MoveToFront(elem)
+
+		entry := elem.Value.(*dedupEntry)
+		if now.Sub(entry.lastSent) < d.window {
+			entry.suppressed++
+			entry.event = event
+			return true
+		}
+
+		event.DuplicateCount = entry.suppressed
+		entry.event = event
+		entry.lastSent = now
+		entry.suppressed = 0
+
+		return false
+	}
+
+	// Counts for evicted entries are lost, this only happens if there are a
+	// huge number of distinct events within the window.
+	if d.lru.Len() >= maxDedupEntries {
+		oldest := d.lru.Back()
+		d.lru.Remove(oldest)
+		delete(d.entries, oldest.Value.(*dedupEntry).hash)
+	}
+
+	d.entries[hash] = d.lru.PushFront(&dedupEntry{
+		hash:     hash,
+		event:    event,
+		lastSent: now,
+	})
+
+	return false
+}
+
+// drain returns the most recent occurrence of each event with suppressed
+// duplicates, with the number of duplicates attached.
+func (d *deduplicator) drain() []*v1alpha1.TelemetryEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+
+	var events []*v1alpha1.TelemetryEvent
+	for elem := d.lru.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*dedupEntry)
+		if entry.suppressed == 0 {
+			continue
+		}
+
+		event := proto.Clone(entry.event).(*v1alpha1.TelemetryEvent)
+		event.DuplicateCount = entry.suppressed
+		events = append(events, event)
+
+		entry.lastSent = now
+		entry.suppressed = 0
+	}
+
+	return events
+}
+
+// hashEvent returns a hash of the event contents, ignoring the timestamp and
+// session.
+func hashEvent(event *v1alpha1.TelemetryEvent) [sha256.Size]byte {
+	event = proto.Clone(event).(*v1alpha1.TelemetryEvent)
+	event.Timestamp = nil
+	event.SessionId = ""
+	event.PreviousSessionId = ""
+	event.DuplicateCount = 0
+
+	data, _ := proto.MarshalOptions{Deterministic: true}.Marshal(event)
+	return sha256.Sum256(data)
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/telemetrytest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplication(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	clock := telemetrytest.NewClock(time.Now())
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:     baseURL,
+		DedupWindow: time.Minute,
+		Clock:       clock,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	reconnecting := func() *v1alpha1.TelemetryEvent {
+		return &v1alpha1.TelemetryEvent{
+			Name:   "reconnecting",
+			Labels: []*v1alpha1.Label{{Key: "peer", Value: "a"}},
+		}
+	}
+
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(reconnecting()))
+	require.Equal(t, telemetry.StatusDroppedDuplicate, r.ReportEventResult(reconnecting()))
+	require.Equal(t, telemetry.StatusDroppedDuplicate, r.ReportEventResult(reconnecting()))
+
+	// Events with different labels aren't duplicates.
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{
+		Name:   "reconnecting",
+		Labels: []*v1alpha1.Label{{Key: "peer", Value: "b"}},
+	}))
+
+	clock.Advance(time.Minute)
+
+	// The next occurrence after the window carries the suppressed count.
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(reconnecting()))
+	require.Equal(t, telemetry.StatusDroppedDuplicate, r.ReportEventResult(reconnecting()))
+
+	// Flushing reports any outstanding suppressed duplicates.
+	require.NoError(t, r.Flush(ctx))
+
+	var duplicateCounts []int64
+	for len(svc.receivedEvents) > 0 {
+		ev := <-svc.receivedEvents
+		if ev.Labels[0].Value == "a" {
+			duplicateCounts = append(duplicateCounts, ev.DuplicateCount)
+		}
+	}
+
+	require.ElementsMatch(t, []int64{0, 2, 1}, duplicateCounts)
+}
+
+func TestDeduplicationInterceptor(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:     baseURL,
+		DedupWindow: time.Minute,
+		Interceptors: []telemetry.Interceptor{
+			func(next telemetry.SendFunc) telemetry.SendFunc {
+				return func(ctx context.Context, event *v1alpha1.TelemetryEvent) telemetry.Status {
+					if event.Name == "secret" {
+						return telemetry.StatusDroppedIntercepted
+					}
+					return next(ctx, event)
+				}
+			},
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.Equal(t, telemetry.StatusDroppedIntercepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "secret"}))
+	require.Equal(t, telemetry.StatusDroppedDuplicate, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "secret"}))
+
+	// The summary of the suppressed duplicates is intercepted too.
+	require.NoError(t, r.Flush(ctx))
+	require.Empty(t, svc.receivedEvents)
+}
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The name of the event reported when reporting is re-enabled, counting the
+// events dropped while it was disabled.
+const droppedWhileDisabledEventName = "telemetry_dropped_while_disabled"
+
+// markDisabled starts counting the events dropped while reporting is
+// disabled.
+func (r *Reporter) markDisabled() {
+	now := r.clock.Now()
+	r.disabledSince.Store(&now)
+	r.disabledDrops.Store(0)
+
+	r.discardHeld()
+}
+
+// discardHeld discards the events held back to be reported later (counters,
+// rollups, and suppressed duplicates), so that nothing recorded before
+// reporting was disabled is sent once it's enabled again.
+func (r *Reporter) discardHeld() {
+	if r.counters != nil {
+		_ = r.counters.drain()
+	}
+
+	if r.rollup != nil {
+		_ = r.rollup.drain()
+	}
+
+	if r.dedup != nil {
+		_ = r.dedup.drain()
+	}
+}
+
+// reportDroppedWhileDisabled reports the number of events dropped while
+// reporting was disabled, but not the events themselves.
+func (r *Reporter) reportDroppedWhileDisabled() {
+	dropped := r.disabledDrops.Swap(0)
+	if !r.reportDisabledDrops || dropped == 0 {
+		return
+	}
+
+	event := &v1alpha1.TelemetryEvent{
+		Kind: v1alpha1.TelemetryEventKind_INFO,
+		Name: droppedWhileDisabledEventName,
+		Counter: &v1alpha1.Counter{
+			Value: int64(dropped),
+		},
+	}
+	if since := r.disabledSince.Load(); since != nil {
+		event.Counter.StartTime = timestamppb.New(*since)
+	}
+
+	_ = r.ReportEventImportant(event)
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import "github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+
+// DropReason is the reason an event was dropped, see Configuration.OnDrop.
+type DropReason int
+
+const (
+	// DropReasonDisabled means telemetry is disabled.
+	DropReasonDisabled DropReason = iota
+	// DropReasonShuttingDown means the reporter is shutting down (or closed).
+	DropReasonShuttingDown
+	// DropReasonOverflow means there were too many pending reports, either
+	// when the event was reported, or while it was waiting to be sent.
+	DropReasonOverflow
+	// DropReasonSampled means the event was dropped by sampling.
+	DropReasonSampled
+	// DropReasonRateLimited means the event was dropped by rate limiting.
+	DropReasonRateLimited
+	// DropReasonCircuitOpen means reporting is paused after repeated
+	// failures.
+	DropReasonCircuitOpen
+	// DropReasonDuplicate means the event was suppressed as a duplicate.
+	DropReasonDuplicate
+	// DropReasonInvalid means the event failed validation.
+	DropReasonInvalid
+	// DropReasonCanceled means the caller's context was done.
+	DropReasonCanceled
+	// DropReasonIntercepted means one of the configured interceptors dropped
+	// the event.
+	DropReasonIntercepted
+)
+
+func (d DropReason) String() string {
+	switch d {
+	case DropReasonDisabled:
+		return "Disabled"
+	case DropReasonShuttingDown:
+		return "ShuttingDown"
+	case DropReasonOverflow:
+		return "Overflow"
+	case DropReasonSampled:
+		return "Sampled"
+	case DropReasonRateLimited:
+		return "RateLimited"
+	case DropReasonCircuitOpen:
+		return "CircuitOpen"
+	case DropReasonDuplicate:
+		return "Duplicate"
+	case DropReasonInvalid:
+		return "Invalid"
+	case DropReasonCanceled:
+		return "Canceled"
+	case DropReasonIntercepted:
+		return "Intercepted"
+	default:
+		return "Unknown"
+	}
+}
+
+// dropReasons maps the status of a dropped event to the reason.
+var dropReasons = map[Status]DropReason{
+	StatusDroppedDisabled:     DropReasonDisabled,
+	StatusDroppedShuttingDown: DropReasonShuttingDown,
+	StatusDroppedOverflow:     DropReasonOverflow,
+	StatusDroppedSampled:      DropReasonSampled,
+	StatusDroppedRateLimited:  DropReasonRateLimited,
+	StatusDroppedCircuitOpen:  DropReasonCircuitOpen,
+	StatusDroppedDuplicate:    DropReasonDuplicate,
+	StatusDroppedInvalid:      DropReasonInvalid,
+	StatusDroppedCanceled:     DropReasonCanceled,
+	StatusDroppedIntercepted:  DropReasonIntercepted,
+}
+
+// recordStatus records the outcome of reporting an event, calling the OnDrop
+// hook if it was dropped.
+func (r *Reporter) recordStatus(event *v1alpha1.TelemetryEvent, status Status) {
+	r.stats.record(status)
+
+	if reason, ok := dropReasons[status]; ok && r.onDrop != nil {
+		r.onDrop(event, reason)
+	}
+}
+
+// recordOverflowDrops records already accepted events that were dropped due
+// to too many pending reports.
+func (r *Reporter) recordOverflowDrops(events []*v1alpha1.TelemetryEvent) {
+	r.stats.droppedOverflow.Add(uint64(len(events)))
+
+	if r.onDrop != nil {
+		for _, event := range events {
+			r.onDrop(event, DropReasonOverflow)
+		}
+	}
+}
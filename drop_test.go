@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1/v1alpha1connect"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOnDrop(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	dropped := func() *v1alpha1.TelemetryEvent {
+		return &v1alpha1.TelemetryEvent{Name: "dropped"}
+	}
+
+	for _, tc := range []struct {
+		reason telemetry.DropReason
+		svc    func(t *testing.T) v1alpha1connect.TelemetryHandler
+		conf   telemetry.Configuration
+		report func(t *testing.T, r *telemetry.Reporter)
+	}{
+		{
+			reason: telemetry.DropReasonDisabled,
+			report: func(t *testing.T, r *telemetry.Reporter) {
+				r.SetEnabled(false)
+				r.ReportEvent(dropped())
+			},
+		},
+		{
+			reason: telemetry.DropReasonShuttingDown,
+			report: func(t *testing.T, r *telemetry.Reporter) {
+				require.NoError(t, r.Shutdown(ctx))
+				r.ReportEvent(dropped())
+			},
+		},
+		{
+			reason: telemetry.DropReasonOverflow,
+			svc: func(t *testing.T) v1alpha1connect.TelemetryHandler {
+				svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+				t.Cleanup(func() { close(svc.release) })
+				return svc
+			},
+			conf: telemetry.Configuration{QueueSize: 1},
+			report: func(t *testing.T, r *telemetry.Reporter) {
+				r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+				r.ReportEvent(dropped())
+			},
+		},
+		{
+			reason: telemetry.DropReasonSampled,
+			conf:   telemetry.Configuration{SampleRate: 1e-12},
+			report: func(t *testing.T, r *telemetry.Reporter) {
+				r.ReportEvent(dropped())
+			},
+		},
+		{
+			reason: telemetry.DropReasonRateLimited,
+			conf: telemetry.Configuration{
+				RateLimits: map[string]telemetry.RateLimit{
+					"dropped": {Rate: 0.0001, Burst: 1},
+				},
+			},
+			report: func(t *testing.T, r *telemetry.Reporter) {
+				r.ReportEvent(dropped())
+				r.ReportEvent(dropped())
+			},
+		},
+		{
+			reason: telemetry.DropReasonCircuitOpen,
+			conf: telemetry.Configuration{
+				BaseURL:          "http://" + deadAddr(t),
+				FailureThreshold: 1,
+				CooldownPeriod:   time.Minute,
+			},
+			report: func(t *testing.T, r *telemetry.Reporter) {
+				r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+				require.NoError(t, r.Flush(ctx))
+				r.ReportEvent(dropped())
+			},
+		},
+		{
+			reason: telemetry.DropReasonDuplicate,
+			conf:   telemetry.Configuration{DedupWindow: time.Hour},
+			report: func(t *testing.T, r *telemetry.Reporter) {
+				r.ReportEvent(dropped())
+				r.ReportEvent(dropped())
+			},
+		},
+		{
+			reason: telemetry.DropReasonInvalid,
+			report: func(t *testing.T, r *telemetry.Reporter) {
+				r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "dropped", Kind: 99})
+			},
+		},
+		{
+			reason: telemetry.DropReasonCanceled,
+			report: func(t *testing.T, r *telemetry.Reporter) {
+				canceledCtx, cancel := context.WithCancel(ctx)
+				cancel()
+				r.ReportEventContext(canceledCtx, dropped())
+			},
+		},
+		{
+			reason: telemetry.DropReasonIntercepted,
+			conf: telemetry.Configuration{
+				Interceptors: []telemetry.Interceptor{
+					func(next telemetry.SendFunc) telemetry.SendFunc {
+						return func(ctx context.Context, event *v1alpha1.TelemetryEvent) telemetry.Status {
+							return telemetry.StatusDroppedIntercepted
+						}
+					},
+				},
+			},
+			report: func(t *testing.T, r *telemetry.Reporter) {
+				r.ReportEvent(dropped())
+			},
+		},
+	} {
+		t.Run(tc.reason.String(), func(t *testing.T) {
+			conf := tc.conf
+			if conf.BaseURL == "" {
+				var svc v1alpha1connect.TelemetryHandler = newMockSvc()
+				if tc.svc != nil {
+					svc = tc.svc(t)
+				}
+				conf.BaseURL = startServer(t, svc)
+			}
+
+			type drop struct {
+				event  *v1alpha1.TelemetryEvent
+				reason telemetry.DropReason
+			}
+			drops := make(chan drop, 10)
+			conf.OnDrop = func(event *v1alpha1.TelemetryEvent, reason telemetry.DropReason) {
+				drops <- drop{event: event, reason: reason}
+			}
+
+			r := telemetry.NewReporter(ctx, logger, conf)
+			t.Cleanup(func() {
+				require.NoError(t, r.Close())
+			})
+
+			tc.report(t, r)
+
+			select {
+			case d := <-drops:
+				require.Equal(t, tc.reason, d.reason)
+				require.Equal(t, "dropped", d.event.Name)
+			case <-ctx.Done():
+				t.Fatal("timed out waiting for drop")
+			}
+
+			require.Empty(t, drops)
+		})
+	}
+}
+
+func TestOnDropQueuedEvents(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+	baseURL := startServer(t, svc)
+
+	reasons := make(chan telemetry.DropReason, 10)
+
+	// Larger than the number of workers, so that some reports are queued.
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:        baseURL,
+		QueueSize:      20,
+		OverflowPolicy: telemetry.OverflowDropOldest,
+		OnDrop: func(_ *v1alpha1.TelemetryEvent, reason telemetry.DropReason) {
+			reasons <- reason
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	// The oldest queued event is evicted, after it was accepted.
+	for i := 0; i < 21; i++ {
+		require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+	}
+
+	close(svc.release)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, reasons, 1)
+	require.Equal(t, telemetry.DropReasonOverflow, <-reasons)
+}
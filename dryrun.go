@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"log/slog"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// logDryRun logs the events that would have been reported.
+func (r *Reporter) logDryRun(events []*v1alpha1.TelemetryEvent) {
+	for _, event := range events {
+		data, err := protojson.Marshal(event)
+		if err != nil {
+			r.logger.Warn("Failed to marshal event", slog.Any("error", err))
+			continue
+		}
+
+		r.logger.Info("Dry run, not reporting event", slog.String("event", string(data)))
+	}
+}
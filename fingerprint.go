@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Reserved label used to record the environment fingerprint.
+const fingerprintLabelKey = "environment_fingerprint"
+
+// The number of hex characters of the hash included in the fingerprint.
+const fingerprintLength = 12
+
+// FingerprintSource is the input hashed to fingerprint the environment.
+type FingerprintSource int
+
+const (
+	// FingerprintOff disables the environment fingerprint.
+	FingerprintOff FingerprintSource = iota
+	// FingerprintHostname hashes the hostname.
+	FingerprintHostname
+	// FingerprintFile hashes the contents of a file, eg. /etc/machine-id.
+	FingerprintFile
+	// FingerprintValue hashes a caller provided string, eg. "staging".
+	FingerprintValue
+)
+
+// EnvironmentFingerprint configures a stable, hashed identifier for the
+// environment (eg. to distinguish production from staging). Only a truncated
+// hash is ever reported, never the input itself.
+type EnvironmentFingerprint struct {
+	// Source is the input to hash. Defaults to FingerprintOff.
+	Source FingerprintSource
+	// Path is the file to hash with FingerprintFile.
+	Path string
+	// Value is the string to hash with FingerprintValue.
+	Value string
+}
+
+// fingerprint returns the truncated hash of the configured source.
+func (f EnvironmentFingerprint) fingerprint() (string, error) {
+	var input string
+	switch f.Source {
+	case FingerprintHostname:
+		hostname, err := os.Hostname()
+		if err != nil {
+			return "", fmt.Errorf("failed to get hostname: %w", err)
+		}
+		input = hostname
+	case FingerprintFile:
+		data, err := os.ReadFile(f.Path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read fingerprint file: %w", err)
+		}
+		// Ignore any trailing newline.
+		input = strings.TrimSpace(string(data))
+	case FingerprintValue:
+		input = f.Value
+	default:
+		return "", fmt.Errorf("unsupported fingerprint source: %d", f.Source)
+	}
+
+	if input == "" {
+		return "", errors.New("empty fingerprint input")
+	}
+
+	sum := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(sum[:])[:fingerprintLength], nil
+}
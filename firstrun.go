@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// The name of the event reported the first time a reporter is created.
+	installEventName = "install"
+	// The name of the file marking that a reporter has run before.
+	installMarkerName = "installed"
+)
+
+// markInstalled records that a reporter has run, returning true if this is
+// the first time. The marker is created exclusively, so only one of several
+// processes starting at once will see the first run.
+func markInstalled(clock Clock, stateDir string) (bool, error) {
+	if err := os.MkdirAll(stateDir, 0o700); err != nil {
+		return false, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	f, err := os.OpenFile(filepath.Join(stateDir, installMarkerName), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("failed to create install marker: %w", err)
+	}
+	defer f.Close()
+
+	// Purely informational.
+	_, _ = f.WriteString(clock.Now().UTC().Format(time.RFC3339) + "\n")
+
+	return true, nil
+}
+
+// IsFirstRun returns true if this is the first time a reporter has been
+// created with the configured state directory.
+func (r *Reporter) IsFirstRun() bool {
+	return r.firstRun
+}
@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirstRun(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	stateDir := t.TempDir()
+
+	for _, firstRun := range []bool{true, false} {
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:  baseURL,
+			StateDir: stateDir,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		require.Equal(t, firstRun, r.IsFirstRun())
+		require.NoError(t, r.Flush(ctx))
+
+		if firstRun {
+			require.Len(t, svc.receivedEvents, 1)
+			require.Equal(t, "install", (<-svc.receivedEvents).Name)
+		} else {
+			require.Empty(t, svc.receivedEvents)
+		}
+	}
+
+	// Disabled by default.
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.False(t, r.IsFirstRun())
+}
+
+func TestFirstRunConcurrent(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	stateDir := t.TempDir()
+	baseURL := "http://" + deadAddr(t)
+
+	var wg sync.WaitGroup
+	var firstRuns atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+				BaseURL:  baseURL,
+				StateDir: stateDir,
+			})
+			defer r.Close()
+
+			if r.IsFirstRun() {
+				firstRuns.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(1), firstRuns.Load())
+}
@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// periodicFlusher flushes held back events at a fixed interval, bounding how
+// long they may wait regardless of how often new events arrive.
+type periodicFlusher struct {
+	stopping chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newPeriodicFlusher() *periodicFlusher {
+	return &periodicFlusher{
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// run calls flush every interval until stopped, or ctx is canceled.
+func (f *periodicFlusher) run(ctx context.Context, interval time.Duration, flush func()) {
+	defer close(f.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-f.stopping:
+			return
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// stop waits for the flusher to exit.
+func (f *periodicFlusher) stop() {
+	f.stopOnce.Do(func() {
+		close(f.stopping)
+	})
+
+	<-f.done
+}
+
+// flushPeriodically reports any buffered events and suppressed duplicates.
+// Throttled events are left alone, as the throttle determines when they can
+// be reported.
+func (r *Reporter) flushPeriodically() {
+	r.flushDuplicates()
+
+	if r.batcher != nil {
+		_ = r.batcher.flushBuffered(r.reportsCtx)
+	}
+}
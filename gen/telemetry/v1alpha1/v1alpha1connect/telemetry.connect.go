@@ -44,17 +44,28 @@ const (
 const (
 	// TelemetryReportProcedure is the fully-qualified name of the Telemetry's Report RPC.
 	TelemetryReportProcedure = "/noisysockets.telemetry.v1alpha1.Telemetry/Report"
+	// TelemetryBatchReportProcedure is the fully-qualified name of the Telemetry's BatchReport RPC.
+	TelemetryBatchReportProcedure = "/noisysockets.telemetry.v1alpha1.Telemetry/BatchReport"
+	// TelemetryStreamReportProcedure is the fully-qualified name of the Telemetry's StreamReport RPC.
+	TelemetryStreamReportProcedure = "/noisysockets.telemetry.v1alpha1.Telemetry/StreamReport"
 )
 
 // These variables are the protoreflect.Descriptor objects for the RPCs defined in this package.
 var (
-	telemetryServiceDescriptor      = v1alpha1.File_telemetry_v1alpha1_telemetry_proto.Services().ByName("Telemetry")
-	telemetryReportMethodDescriptor = telemetryServiceDescriptor.Methods().ByName("Report")
+	telemetryServiceDescriptor            = v1alpha1.File_telemetry_v1alpha1_telemetry_proto.Services().ByName("Telemetry")
+	telemetryReportMethodDescriptor       = telemetryServiceDescriptor.Methods().ByName("Report")
+	telemetryBatchReportMethodDescriptor  = telemetryServiceDescriptor.Methods().ByName("BatchReport")
+	telemetryStreamReportMethodDescriptor = telemetryServiceDescriptor.Methods().ByName("StreamReport")
 )
 
 // TelemetryClient is a client for the noisysockets.telemetry.v1alpha1.Telemetry service.
 type TelemetryClient interface {
 	Report(context.Context, *connect.Request[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error)
+	// BatchReport reports multiple telemetry events in a single request.
+	BatchReport(context.Context, *connect.Request[v1alpha1.TelemetryEventBatch]) (*connect.Response[emptypb.Empty], error)
+	// StreamReport reports telemetry events over a long-lived stream, for
+	// clients with high event rates.
+	StreamReport(context.Context) *connect.ClientStreamForClient[v1alpha1.TelemetryEvent, emptypb.Empty]
 }
 
 // NewTelemetryClient constructs a client for the noisysockets.telemetry.v1alpha1.Telemetry service.
@@ -73,12 +84,26 @@ func NewTelemetryClient(httpClient connect.HTTPClient, baseURL string, opts ...c
 			connect.WithSchema(telemetryReportMethodDescriptor),
 			connect.WithClientOptions(opts...),
 		),
+		batchReport: connect.NewClient[v1alpha1.TelemetryEventBatch, emptypb.Empty](
+			httpClient,
+			baseURL+TelemetryBatchReportProcedure,
+			connect.WithSchema(telemetryBatchReportMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
+		streamReport: connect.NewClient[v1alpha1.TelemetryEvent, emptypb.Empty](
+			httpClient,
+			baseURL+TelemetryStreamReportProcedure,
+			connect.WithSchema(telemetryStreamReportMethodDescriptor),
+			connect.WithClientOptions(opts...),
+		),
 	}
 }
 
 // telemetryClient implements TelemetryClient.
 type telemetryClient struct {
-	report *connect.Client[v1alpha1.TelemetryEvent, emptypb.Empty]
+	report       *connect.Client[v1alpha1.TelemetryEvent, emptypb.Empty]
+	batchReport  *connect.Client[v1alpha1.TelemetryEventBatch, emptypb.Empty]
+	streamReport *connect.Client[v1alpha1.TelemetryEvent, emptypb.Empty]
 }
 
 // Report calls noisysockets.telemetry.v1alpha1.Telemetry.Report.
@@ -86,9 +111,24 @@ func (c *telemetryClient) Report(ctx context.Context, req *connect.Request[v1alp
 	return c.report.CallUnary(ctx, req)
 }
 
+// BatchReport calls noisysockets.telemetry.v1alpha1.Telemetry.BatchReport.
+func (c *telemetryClient) BatchReport(ctx context.Context, req *connect.Request[v1alpha1.TelemetryEventBatch]) (*connect.Response[emptypb.Empty], error) {
+	return c.batchReport.CallUnary(ctx, req)
+}
+
+// StreamReport calls noisysockets.telemetry.v1alpha1.Telemetry.StreamReport.
+func (c *telemetryClient) StreamReport(ctx context.Context) *connect.ClientStreamForClient[v1alpha1.TelemetryEvent, emptypb.Empty] {
+	return c.streamReport.CallClientStream(ctx)
+}
+
 // TelemetryHandler is an implementation of the noisysockets.telemetry.v1alpha1.Telemetry service.
 type TelemetryHandler interface {
 	Report(context.Context, *connect.Request[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error)
+	// BatchReport reports multiple telemetry events in a single request.
+	BatchReport(context.Context, *connect.Request[v1alpha1.TelemetryEventBatch]) (*connect.Response[emptypb.Empty], error)
+	// StreamReport reports telemetry events over a long-lived stream, for
+	// clients with high event rates.
+	StreamReport(context.Context, *connect.ClientStream[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error)
 }
 
 // NewTelemetryHandler builds an HTTP handler from the service implementation. It returns the path
@@ -103,10 +143,26 @@ func NewTelemetryHandler(svc TelemetryHandler, opts ...connect.HandlerOption) (s
 		connect.WithSchema(telemetryReportMethodDescriptor),
 		connect.WithHandlerOptions(opts...),
 	)
+	telemetryBatchReportHandler := connect.NewUnaryHandler(
+		TelemetryBatchReportProcedure,
+		svc.BatchReport,
+		connect.WithSchema(telemetryBatchReportMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
+	telemetryStreamReportHandler := connect.NewClientStreamHandler(
+		TelemetryStreamReportProcedure,
+		svc.StreamReport,
+		connect.WithSchema(telemetryStreamReportMethodDescriptor),
+		connect.WithHandlerOptions(opts...),
+	)
 	return "/noisysockets.telemetry.v1alpha1.Telemetry/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.URL.Path {
 		case TelemetryReportProcedure:
 			telemetryReportHandler.ServeHTTP(w, r)
+		case TelemetryBatchReportProcedure:
+			telemetryBatchReportHandler.ServeHTTP(w, r)
+		case TelemetryStreamReportProcedure:
+			telemetryStreamReportHandler.ServeHTTP(w, r)
 		default:
 			http.NotFound(w, r)
 		}
@@ -119,3 +175,11 @@ type UnimplementedTelemetryHandler struct{}
 func (UnimplementedTelemetryHandler) Report(context.Context, *connect.Request[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error) {
 	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("noisysockets.telemetry.v1alpha1.Telemetry.Report is not implemented"))
 }
+
+func (UnimplementedTelemetryHandler) BatchReport(context.Context, *connect.Request[v1alpha1.TelemetryEventBatch]) (*connect.Response[emptypb.Empty], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("noisysockets.telemetry.v1alpha1.Telemetry.BatchReport is not implemented"))
+}
+
+func (UnimplementedTelemetryHandler) StreamReport(context.Context, *connect.ClientStream[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("noisysockets.telemetry.v1alpha1.Telemetry.StreamReport is not implemented"))
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"log/slog"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// Reserved label used to record the coarse location of the client.
+const geoLabelKey = "geo_hint"
+
+// Matches anything that looks like an IPv4 address embedded in a string.
+var ipv4Pattern = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}\b`)
+
+// containsIP returns whether a value contains something that looks like an IP
+// address (or prefix, or address and port).
+func containsIP(value string) bool {
+	if ipv4Pattern.MatchString(value) {
+		return true
+	}
+
+	// IPv6 addresses can't be reliably spotted in free text, so only look at
+	// each field.
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ' ' || r == ',' || r == '=' || r == '[' || r == ']' || r == '/'
+	}) {
+		if _, err := netip.ParseAddr(field); err == nil {
+			return true
+		}
+		if _, err := netip.ParseAddrPort(field); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withoutIPs returns the labels without any whose values look like IP
+// addresses, along with the keys of those removed. The labels are copied
+// rather than modified if any are removed.
+func withoutIPs(labels map[string]string) (map[string]string, []string) {
+	var removed []string
+	for key, value := range labels {
+		if containsIP(value) {
+			removed = append(removed, key)
+		}
+	}
+
+	if len(removed) == 0 {
+		return labels, nil
+	}
+
+	filtered := make(map[string]string, len(labels)-len(removed))
+	for key, value := range labels {
+		if !containsIP(value) {
+			filtered[key] = value
+		}
+	}
+
+	return filtered, removed
+}
+
+// labelsWithoutIPs returns the labels that don't look like IP addresses,
+// warning about any that do.
+func labelsWithoutIPs(logger *slog.Logger, labels map[string]string) map[string]string {
+	labels, removed := withoutIPs(labels)
+	for _, key := range removed {
+		logger.Warn("Ignoring label that looks like an IP address", slog.String("key", key))
+	}
+
+	return labels
+}
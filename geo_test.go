@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"net/netip"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoHint(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for geoHint, want := range map[string]string{
+		"IE":          "IE",
+		"eu-west":     "eu-west",
+		"192.0.2.1":   "",
+		"2001:db8::1": "",
+	} {
+		svc := newMockSvc()
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL: baseURL,
+			GeoHint: geoHint,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+
+		require.Equal(t, want, labelsToMap((<-svc.receivedEvents).Labels)["geo_hint"])
+	}
+}
+
+func TestNoIPsFromEnrichment(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:                baseURL,
+		AppName:                "nsh",
+		AppVersion:             "1.2.3",
+		IncludeRuntimeInfo:     true,
+		EnvironmentFingerprint: telemetry.EnvironmentFingerprint{Source: telemetry.FingerprintHostname},
+		GeoHint:                "fe80::1",
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	ev := <-svc.receivedEvents
+
+	for _, tag := range ev.Tags {
+		require.False(t, looksLikeIP(tag), "tag %q looks like an IP address", tag)
+	}
+
+	labels := labelsToMap(ev.Labels)
+	for key, value := range labels {
+		require.False(t, looksLikeIP(value), "label %q looks like an IP address: %q", key, value)
+	}
+	require.NotEmpty(t, labels["environment_fingerprint"])
+	require.NotContains(t, labels, "geo_hint")
+}
+
+func TestApplicationIPLikeValues(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	type addrKey struct{}
+
+	// Values supplied by the application are sent as is, eg. four part
+	// version numbers.
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		Tags:    []string{"1.2.3.4"},
+		TagFunc: func() []string {
+			return []string{"10.0.0.1"}
+		},
+		Labels: map[string]string{
+			"build": "2024.6.1.7",
+		},
+		ContextExtractor: func(ctx context.Context) map[string]string {
+			return map[string]string{"remote": ctx.Value(addrKey{}).(string)}
+		},
+		OmitLibraryVersion: true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEventContext(context.WithValue(ctx, addrKey{}, "[2001:db8::1]:443"), &v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	ev := <-svc.receivedEvents
+	require.Equal(t, []string{"1.2.3.4", "10.0.0.1"}, ev.Tags)
+	require.Equal(t, map[string]string{
+		"build":  "2024.6.1.7",
+		"remote": "[2001:db8::1]:443",
+	}, labelsToMap(ev.Labels))
+}
+
+var ipv4Pattern = regexp.MustCompile(`\d{1,3}(\.\d{1,3}){3}`)
+
+func looksLikeIP(value string) bool {
+	if ipv4Pattern.MatchString(value) {
+		return true
+	}
+
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool {
+		return strings.ContainsRune(" ,=[]/", r)
+	}) {
+		if _, err := netip.ParseAddr(field); err == nil {
+			return true
+		}
+		if _, err := netip.ParseAddrPort(field); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
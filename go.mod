@@ -4,6 +4,7 @@ go 1.22.4
 
 require (
 	connectrpc.com/connect v1.16.2
+	github.com/klauspost/compress v1.18.0
 	github.com/neilotoole/slogt v1.1.0
 	github.com/stretchr/testify v1.9.0
 	golang.org/x/net v0.23.0
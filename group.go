@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ ReporterInterface = (*ReporterGroup)(nil)
+
+// ReporterGroup fans out telemetry events to multiple reporters, eg. to send
+// the same telemetry to independent backends. Each member keeps its own
+// configuration and session.
+type ReporterGroup struct {
+	members []ReporterInterface
+}
+
+// NewReporterGroup creates a new reporter group with the given members.
+func NewReporterGroup(members ...ReporterInterface) *ReporterGroup {
+	return &ReporterGroup{members: members}
+}
+
+// ReportEvent reports a telemetry event to every member.
+func (g *ReporterGroup) ReportEvent(event *v1alpha1.TelemetryEvent) {
+	g.ReportEventContext(context.Background(), event)
+}
+
+// ReportEventContext reports a telemetry event to every member, respecting
+// cancellation of ctx.
+func (g *ReporterGroup) ReportEventContext(ctx context.Context, event *v1alpha1.TelemetryEvent) {
+	for i, member := range g.members {
+		// Reporters modify the events they are given (eg. adding tags), so
+		// each member gets its own copy.
+		memberEvent := event
+		if i < len(g.members)-1 {
+			memberEvent = proto.Clone(event).(*v1alpha1.TelemetryEvent)
+		}
+
+		member.ReportEventContext(ctx, memberEvent)
+	}
+}
+
+// Flush blocks until every member has reported its pending events, or the
+// context expires.
+func (g *ReporterGroup) Flush(ctx context.Context) error {
+	return g.each(func(member ReporterInterface) error {
+		return member.Flush(ctx)
+	})
+}
+
+// Shutdown gracefully shuts down every member, returning the errors from all
+// of them.
+func (g *ReporterGroup) Shutdown(ctx context.Context) error {
+	return g.each(func(member ReporterInterface) error {
+		return member.Shutdown(ctx)
+	})
+}
+
+// Close aborts any ongoing reporting by every member, returning the errors
+// from all of them.
+func (g *ReporterGroup) Close() error {
+	return g.each(func(member ReporterInterface) error {
+		return member.Close()
+	})
+}
+
+// each calls fn for every member concurrently, so that a slow member doesn't
+// hold up the others, and joins the resulting errors.
+func (g *ReporterGroup) each(fn func(member ReporterInterface) error) error {
+	errs := make([]error, len(g.members))
+
+	var wg sync.WaitGroup
+	for i, member := range g.members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(member)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReporterGroup(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svcA := newMockSvc()
+	svcB := newMockSvc()
+
+	a := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: startServer(t, svcA),
+		Tags:    []string{"a"},
+	})
+	b := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: startServer(t, svcB),
+		Tags:    []string{"b"},
+	})
+
+	g := telemetry.NewReporterGroup(a, b)
+	t.Cleanup(func() {
+		require.NoError(t, g.Close())
+	})
+
+	g.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, g.Flush(ctx))
+
+	evA := <-svcA.receivedEvents
+	require.Equal(t, "test", evA.Name)
+	require.Equal(t, []string{"a"}, evA.Tags)
+	require.Equal(t, a.SessionID(), evA.SessionId)
+
+	evB := <-svcB.receivedEvents
+	require.Equal(t, "test", evB.Name)
+	require.Equal(t, []string{"b"}, evB.Tags)
+	require.Equal(t, b.SessionID(), evB.SessionId)
+
+	require.NoError(t, g.Shutdown(ctx))
+}
+
+func TestReporterGroupErrors(t *testing.T) {
+	errA := errors.New("a")
+	errB := errors.New("b")
+
+	g := telemetry.NewReporterGroup(
+		&failingReporter{MemoryReporter: telemetry.NewMemoryReporter(), err: errA},
+		telemetry.NewMemoryReporter(),
+		&failingReporter{MemoryReporter: telemetry.NewMemoryReporter(), err: errB},
+	)
+
+	err := g.Shutdown(context.Background())
+	require.ErrorIs(t, err, errA)
+	require.ErrorIs(t, err, errB)
+}
+
+type failingReporter struct {
+	*telemetry.MemoryReporter
+	err error
+}
+
+func (r *failingReporter) Shutdown(_ context.Context) error {
+	return r.err
+}
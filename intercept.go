@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+)
+
+// SendFunc hands an event off for reporting, returning the outcome.
+type SendFunc func(ctx context.Context, event *v1alpha1.TelemetryEvent) Status
+
+// Interceptor wraps the sending of every event, eg. to enrich, filter, or
+// observe events. An interceptor may modify the event before calling next, or
+// drop it by returning without calling next (typically with
+// StatusDroppedIntercepted).
+//
+// Interceptors are called after the event has been stamped with the reporter
+// level tags and labels, and has passed validation, sampling, and rate
+// limiting.
+type Interceptor func(next SendFunc) SendFunc
+
+// intercept passes an event through the configured interceptors before
+// handing it to next.
+func (r *Reporter) intercept(ctx context.Context, event *v1alpha1.TelemetryEvent, next SendFunc) Status {
+	send := next
+
+	// The first interceptor is the outermost.
+	for i := len(r.interceptors) - 1; i >= 0; i-- {
+		send = r.interceptors[i](send)
+	}
+
+	return send(ctx, event)
+}
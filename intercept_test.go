@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterceptors(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	var order []string
+
+	dropWarnings := func(next telemetry.SendFunc) telemetry.SendFunc {
+		return func(ctx context.Context, event *v1alpha1.TelemetryEvent) telemetry.Status {
+			order = append(order, "drop")
+
+			if event.Kind == v1alpha1.TelemetryEventKind_WARNING {
+				return telemetry.StatusDroppedIntercepted
+			}
+
+			return next(ctx, event)
+		}
+	}
+
+	enrich := func(next telemetry.SendFunc) telemetry.SendFunc {
+		return func(ctx context.Context, event *v1alpha1.TelemetryEvent) telemetry.Status {
+			order = append(order, "enrich")
+
+			event.Tags = append(event.Tags, "intercepted")
+			return next(ctx, event)
+		}
+	}
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:      baseURL,
+		Interceptors: []telemetry.Interceptor{dropWarnings, enrich},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.Equal(t, telemetry.StatusDroppedIntercepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{
+		Name: "test",
+		Kind: v1alpha1.TelemetryEventKind_WARNING,
+	}))
+	require.Equal(t, []string{"drop"}, order)
+
+	order = nil
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{
+		Name: "test",
+		Kind: v1alpha1.TelemetryEventKind_INFO,
+	}))
+	require.Equal(t, []string{"drop", "enrich"}, order)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, svc.receivedEvents, 1)
+	ev := <-svc.receivedEvents
+	require.Equal(t, v1alpha1.TelemetryEventKind_INFO, ev.Kind)
+	require.Contains(t, ev.Tags, "intercepted")
+
+	require.Equal(t, uint64(1), r.Stats().DroppedIntercepted)
+}
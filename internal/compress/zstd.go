@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+// Package compress provides the compressors registered with connect, beyond
+// the gzip support it has built in.
+package compress
+
+import (
+	"io"
+
+	"connectrpc.com/connect"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Zstd is the name of the zstd compression algorithm, as used in the
+// Content-Encoding header.
+const Zstd = "zstd"
+
+// NewZstdCompressor returns a zstd compressor, for connect.WithAcceptCompression
+// and connect.WithCompression.
+func NewZstdCompressor() connect.Compressor {
+	// Telemetry payloads are small, so a single goroutine is plenty.
+	encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	return encoder
+}
+
+// NewZstdDecompressor returns a zstd decompressor, for
+// connect.WithAcceptCompression and connect.WithCompression.
+func NewZstdDecompressor() connect.Decompressor {
+	// Decodes synchronously, without any background goroutines.
+	decoder, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	return &zstdDecompressor{decoder: decoder}
+}
+
+// zstdDecompressor adapts a zstd decoder to connect.Decompressor. Decoders are
+// pooled by connect, and can't be used once closed, so closing is a no-op.
+type zstdDecompressor struct {
+	decoder *zstd.Decoder
+}
+
+func (d *zstdDecompressor) Read(p []byte) (int, error) {
+	return d.decoder.Read(p)
+}
+
+func (d *zstdDecompressor) Reset(r io.Reader) error {
+	return d.decoder.Reset(r)
+}
+
+func (d *zstdDecompressor) Close() error {
+	return nil
+}
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package compress_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/noisysockets/telemetry/internal/compress"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZstd(t *testing.T) {
+	data := []byte(strings.Repeat("telemetry ", 100))
+
+	compressor := compress.NewZstdCompressor()
+	decompressor := compress.NewZstdDecompressor()
+
+	// Compressors and decompressors are reused after being closed.
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		compressor.Reset(&buf)
+		_, err := compressor.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, compressor.Close())
+		require.Less(t, buf.Len(), len(data))
+
+		require.NoError(t, decompressor.Reset(&buf))
+		decompressed, err := io.ReadAll(decompressor)
+		require.NoError(t, err)
+		require.NoError(t, decompressor.Close())
+		require.Equal(t, data, decompressed)
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket rate limit.
+type Limit struct {
+	// Rate is the number of tokens added to the bucket per second.
+	Rate float64
+	// Burst is the maximum number of tokens in the bucket.
+	Burst int
+}
+
+// Limiter is a set of token bucket rate limiters, keyed by name.
+type Limiter struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	limits  map[string]Limit
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New creates a new limiter with the given per-key limits. Keys without a
+// limit are unlimited. If now is nil, time.Now is used.
+func New(limits map[string]Limit, now func() time.Time) *Limiter {
+	if now == nil {
+		now = time.Now
+	}
+
+	return &Limiter{
+		now:     now,
+		limits:  limits,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow consumes a token for the given key, returning false if the bucket is
+// exhausted.
+func (l *Limiter) Allow(key string) bool {
+	limit, ok := l.limits[key]
+	if !ok {
+		return true
+	}
+
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(limit.Rate))
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed.Seconds()*limit.Rate)
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
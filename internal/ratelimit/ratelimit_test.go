@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/noisysockets/telemetry/internal/ratelimit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+
+	l := ratelimit.New(map[string]ratelimit.Limit{
+		"limited": {Rate: 1, Burst: 2},
+	}, func() time.Time { return now })
+
+	// Unlimited keys are always allowed.
+	for i := 0; i < 10; i++ {
+		require.True(t, l.Allow("unlimited"))
+	}
+
+	// The bucket starts full.
+	require.True(t, l.Allow("limited"))
+	require.True(t, l.Allow("limited"))
+	require.False(t, l.Allow("limited"))
+
+	// Half a token isn't enough.
+	now = now.Add(500 * time.Millisecond)
+	require.False(t, l.Allow("limited"))
+
+	now = now.Add(500 * time.Millisecond)
+	require.True(t, l.Allow("limited"))
+	require.False(t, l.Allow("limited"))
+
+	// The bucket never holds more than the burst.
+	now = now.Add(time.Hour)
+	require.True(t, l.Allow("limited"))
+	require.True(t, l.Allow("limited"))
+	require.False(t, l.Allow("limited"))
+}
@@ -11,20 +11,44 @@ package util
 
 import (
 	"crypto/rand"
-	"math/big"
 )
 
+// AlphanumericAlphabet is the alphabet used by GenerateID.
+const AlphanumericAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
 func GenerateID(n int) string {
-	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	return GenerateIDWithAlphabet(n, AlphanumericAlphabet)
+}
+
+// GenerateIDWithAlphabet generates a random id of length n, using characters
+// drawn uniformly from the given alphabet (of at most 256 characters).
+func GenerateIDWithAlphabet(n int, alphabet string) string {
+	if len(alphabet) == 0 || len(alphabet) > 256 {
+		panic("alphabet must contain between 1 and 256 characters")
+	}
 
-	id := make([]byte, n)
-	for i := range id {
-		r, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters))))
-		if err != nil {
+	// Random bytes greater than or equal to the largest multiple of the
+	// alphabet size are rejected, to avoid modulo bias.
+	limit := 256 - (256 % len(alphabet))
+
+	id := make([]byte, 0, n)
+	// Read a few extra bytes to account for rejections.
+	buf := make([]byte, n+n/4+1)
+	for len(id) < n {
+		if _, err := rand.Read(buf); err != nil {
 			panic(err)
 		}
 
-		id[i] = letters[r.Int64()]
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+
+			id = append(id, alphabet[int(b)%len(alphabet)])
+			if len(id) == n {
+				break
+			}
+		}
 	}
 
 	return string(id)
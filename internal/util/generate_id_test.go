@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package util_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/noisysockets/telemetry/internal/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateID(t *testing.T) {
+	id := util.GenerateID(16)
+	require.Len(t, id, 16)
+
+	for _, c := range id {
+		require.True(t, strings.ContainsRune(util.AlphanumericAlphabet, c))
+	}
+
+	require.NotEqual(t, id, util.GenerateID(16))
+}
+
+func TestGenerateIDWithAlphabetDistribution(t *testing.T) {
+	// Neither alphabet size divides 256, so a naive modulo would be biased.
+	for _, alphabet := range []string{"abc", "01234", util.AlphanumericAlphabet} {
+		const n = 200000
+
+		counts := make(map[rune]int)
+		for _, c := range util.GenerateIDWithAlphabet(n, alphabet) {
+			counts[c]++
+		}
+
+		require.Len(t, counts, len(alphabet))
+
+		expected := float64(n) / float64(len(alphabet))
+		for c, count := range counts {
+			// Allow a generous 10% deviation from the expected count.
+			require.InEpsilon(t, expected, float64(count), 0.1, "character %q", c)
+		}
+	}
+}
+
+func TestGenerateIDWithAlphabetInvalid(t *testing.T) {
+	require.Panics(t, func() {
+		util.GenerateIDWithAlphabet(16, "")
+	})
+}
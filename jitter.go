@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// startupDelay holds back reports until a random delay has elapsed, so that
+// many clients starting at once don't all report at the same time.
+type startupDelay struct {
+	ready chan struct{}
+	once  sync.Once
+	// Guards timer, which may fire before it has been assigned.
+	mu    sync.Mutex
+	timer *time.Timer
+}
+
+func newStartupDelay(jitter time.Duration) *startupDelay {
+	d := &startupDelay{
+		ready: make(chan struct{}),
+	}
+	d.mu.Lock()
+	d.timer = time.AfterFunc(rand.N(jitter), d.release)
+	d.mu.Unlock()
+
+	return d
+}
+
+// release ends the delay early.
+func (d *startupDelay) release() {
+	d.once.Do(func() {
+		d.mu.Lock()
+		d.timer.Stop()
+		d.mu.Unlock()
+
+		close(d.ready)
+	})
+}
+
+// wait blocks until the delay has elapsed or either context is done.
+func (d *startupDelay) wait(ctx, reportsCtx context.Context) error {
+	select {
+	case <-d.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-reportsCtx.Done():
+		return reportsCtx.Err()
+	}
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartupJitter(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	t.Run("Delayed", func(t *testing.T) {
+		svc := newMockSvc()
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:       baseURL,
+			StartupJitter: 100 * time.Millisecond,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		for i := 0; i < 10; i++ {
+			require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		t.Cleanup(cancel)
+
+		require.NoError(t, r.Flush(ctx))
+
+		require.Len(t, svc.receivedEvents, 10)
+	})
+
+	t.Run("Shutdown", func(t *testing.T) {
+		svc := newMockSvc()
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:       baseURL,
+			StartupJitter: time.Hour,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		t.Cleanup(cancel)
+
+		// Shutting down shouldn't wait for the delay to elapse.
+		require.NoError(t, r.Shutdown(ctx))
+
+		require.Len(t, svc.receivedEvents, 1)
+	})
+}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+const (
+	// The default interval after which an idle HTTP/2 connection is health
+	// checked with a ping frame.
+	defaultHTTP2ReadIdleTimeout = 30 * time.Second
+	// The default time to wait for a ping response before closing the
+	// connection.
+	defaultHTTP2PingTimeout = 15 * time.Second
+)
+
+// http2Keepalive holds the HTTP/2 connection health check settings.
+//
+// NATs and firewalls often silently drop idle connections, without notifying
+// either end. Without health checks the next report would be written to a
+// dead connection, and would hang until it timed out before reconnecting.
+// Periodic pings both keep the mapping alive, and detect dead connections so
+// they are replaced before they're needed.
+type http2Keepalive struct {
+	readIdleTimeout time.Duration
+	pingTimeout     time.Duration
+}
+
+func newHTTP2Keepalive(readIdleTimeout, pingTimeout time.Duration) http2Keepalive {
+	if readIdleTimeout == 0 {
+		readIdleTimeout = defaultHTTP2ReadIdleTimeout
+	}
+	if pingTimeout <= 0 {
+		pingTimeout = defaultHTTP2PingTimeout
+	}
+
+	return http2Keepalive{
+		readIdleTimeout: max(0, readIdleTimeout),
+		pingTimeout:     pingTimeout,
+	}
+}
+
+// apply configures the health checks on the given HTTP/2 transport.
+func (k http2Keepalive) apply(t *http2.Transport) {
+	t.ReadIdleTimeout = k.readIdleTimeout
+	t.PingTimeout = k.pingTimeout
+}
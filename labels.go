@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"sort"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+)
+
+// mergeLabels returns the event labels with the reporter labels appended,
+// event labels take precedence on key collisions. Reporter labels are
+// appended in key order.
+func mergeLabels(eventLabels []*v1alpha1.Label, reporterLabels map[string]string) []*v1alpha1.Label {
+	if len(reporterLabels) == 0 {
+		return eventLabels
+	}
+
+	seen := make(map[string]bool, len(eventLabels))
+	for _, label := range eventLabels {
+		seen[label.Key] = true
+	}
+
+	keys := make([]string, 0, len(reporterLabels))
+	for key := range reporterLabels {
+		if !seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		eventLabels = append(eventLabels, &v1alpha1.Label{
+			Key:   key,
+			Value: reporterLabels[key],
+		})
+	}
+
+	return eventLabels
+}
@@ -0,0 +1,407 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabels(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		Labels: map[string]string{
+			"os":      "linux",
+			"version": "1.0",
+		},
+		OmitLibraryVersion: true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{
+		Name: "test",
+		Labels: []*v1alpha1.Label{
+			{Key: "version", Value: "2.0"},
+			{Key: "feature", Value: "foo"},
+		},
+	})
+	require.NoError(t, r.Flush(ctx))
+
+	ev := <-svc.receivedEvents
+	require.Equal(t, map[string]string{
+		"os":      "linux",
+		"version": "2.0",
+		"feature": "foo",
+	}, labelsToMap(ev.Labels))
+
+	// Reporter level labels apply to every event.
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	ev = <-svc.receivedEvents
+	require.Equal(t, map[string]string{
+		"os":      "linux",
+		"version": "1.0",
+	}, labelsToMap(ev.Labels))
+}
+
+func TestMetadataLabels(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for _, omit := range []bool{false, true} {
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:            baseURL,
+			AppName:            "nsh",
+			AppVersion:         "1.2.3",
+			OmitLibraryVersion: omit,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+
+		labels := labelsToMap((<-svc.receivedEvents).Labels)
+		require.Equal(t, "nsh", labels["app_name"])
+		require.Equal(t, "1.2.3", labels["app_version"])
+
+		if omit {
+			require.NotContains(t, labels, "telemetry_version")
+		} else {
+			require.NotEmpty(t, labels["telemetry_version"])
+		}
+	}
+}
+
+func TestRuntimeInfo(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:            baseURL,
+		IncludeRuntimeInfo: true,
+		OmitLibraryVersion: true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	require.Equal(t, map[string]string{
+		"runtime_os":         runtime.GOOS,
+		"runtime_arch":       runtime.GOARCH,
+		"runtime_go_version": runtime.Version(),
+		"runtime_num_cpu":    strconv.Itoa(runtime.NumCPU()),
+	}, labelsToMap((<-svc.receivedEvents).Labels))
+}
+
+func TestEnvironmentFingerprint(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	fingerprintPath := filepath.Join(t.TempDir(), "machine-id")
+	require.NoError(t, os.WriteFile(fingerprintPath, []byte("0123456789abcdef\n"), 0o600))
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		fingerprint telemetry.EnvironmentFingerprint
+		raw         string
+	}{
+		{"Hostname", telemetry.EnvironmentFingerprint{Source: telemetry.FingerprintHostname}, hostname},
+		{"File", telemetry.EnvironmentFingerprint{Source: telemetry.FingerprintFile, Path: fingerprintPath}, "0123456789abcdef"},
+		{"Value", telemetry.EnvironmentFingerprint{Source: telemetry.FingerprintValue, Value: "staging"}, "staging"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fingerprint := func() string {
+				svc := newMockSvc()
+				baseURL := startServer(t, svc)
+
+				r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+					BaseURL:                baseURL,
+					EnvironmentFingerprint: tt.fingerprint,
+				})
+				t.Cleanup(func() {
+					require.NoError(t, r.Close())
+				})
+
+				ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+				t.Cleanup(cancel)
+
+				r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+				require.NoError(t, r.Flush(ctx))
+
+				ev := <-svc.receivedEvents
+				for _, label := range ev.Labels {
+					require.NotContains(t, label.Value, tt.raw)
+				}
+
+				return labelsToMap(ev.Labels)["environment_fingerprint"]
+			}
+
+			first := fingerprint()
+			require.Regexp(t, "^[0-9a-f]{12}$", first)
+
+			// Stable across reporters.
+			require.Equal(t, first, fingerprint())
+		})
+	}
+
+	t.Run("Off", func(t *testing.T) {
+		svc := newMockSvc()
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL: baseURL,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		t.Cleanup(cancel)
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+
+		require.NotContains(t, labelsToMap((<-svc.receivedEvents).Labels), "environment_fingerprint")
+	})
+}
+
+func TestContextExtractor(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	type requestIDKey struct{}
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		Labels: map[string]string{
+			"request_id": "none",
+		},
+		OmitLibraryVersion: true,
+		ContextExtractor: func(ctx context.Context) map[string]string {
+			labels := map[string]string{}
+			if requestID, ok := ctx.Value(requestIDKey{}).(string); ok {
+				labels["request_id"] = requestID
+			}
+			return labels
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEventContext(context.WithValue(ctx, requestIDKey{}, "abc123"), &v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	ev := <-svc.receivedEvents
+	require.Equal(t, map[string]string{
+		"request_id": "abc123",
+	}, labelsToMap(ev.Labels))
+
+	// Missing values are skipped.
+	r.ReportEventContext(ctx, &v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	ev = <-svc.receivedEvents
+	require.Equal(t, map[string]string{
+		"request_id": "none",
+	}, labelsToMap(ev.Labels))
+}
+
+func labelsToMap(labels []*v1alpha1.Label) map[string]string {
+	m := make(map[string]string, len(labels))
+	for _, label := range labels {
+		m[label.Key] = label.Value
+	}
+	return m
+}
+
+func TestMaxDistinctLabelValues(t *testing.T) {
+	ctx := context.Background()
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	var logs lockedBuffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:                baseURL,
+		Labels:                 map[string]string{"region": "eu"},
+		MaxDistinctLabelValues: 3,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	users := []string{"u0", "u1", "u2", "u3", "u4", "u0"}
+	for _, user := range users {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{
+			Name:   user,
+			Labels: []*v1alpha1.Label{{Key: "user", Value: user}},
+		})
+		require.NoError(t, r.Flush(ctx))
+	}
+
+	var got []string
+	for range users {
+		labels := labelsToMap((<-svc.receivedEvents).Labels)
+		require.Equal(t, "eu", labels["region"])
+		got = append(got, labels["user"])
+	}
+
+	// Values already seen are still allowed once the limit is reached.
+	require.Equal(t, []string{"u0", "u1", "u2", telemetry.OverflowLabelValue, telemetry.OverflowLabelValue, "u0"}, got)
+
+	// Only warned about once.
+	require.Equal(t, 1, strings.Count(logs.String(), "Too many distinct label values"))
+}
+
+func TestMaxDistinctLabelValuesEventSessions(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:                baseURL,
+		MaxDistinctLabelValues: 3,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	// Session ids set on the events don't reset the limit.
+	users := []string{"u0", "u1", "u2", "u3", "u4"}
+	for i, user := range users {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{
+			Name:      user,
+			SessionId: []string{"a", "b"}[i%2],
+			Labels:    []*v1alpha1.Label{{Key: "user", Value: user}},
+		})
+		require.NoError(t, r.Flush(ctx))
+	}
+
+	var got []string
+	for range users {
+		got = append(got, labelsToMap((<-svc.receivedEvents).Labels)["user"])
+	}
+
+	require.Equal(t, []string{"u0", "u1", "u2", telemetry.OverflowLabelValue, telemetry.OverflowLabelValue}, got)
+}
+
+func TestSetTagsAndLabels(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		Tags:    []string{"profile:default"},
+		Labels: map[string]string{
+			"network": "home",
+		},
+		AppName:            "test",
+		OmitLibraryVersion: true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "before"})
+
+	r.SetTags("profile:work", "vpn")
+	r.SetLabels(map[string]string{"network": "office"})
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "after"})
+	require.NoError(t, r.Flush(ctx))
+
+	events := make(map[string]*v1alpha1.TelemetryEvent)
+	for i := 0; i < 2; i++ {
+		ev := <-svc.receivedEvents
+		events[ev.Name] = ev
+	}
+
+	require.Equal(t, []string{"profile:default"}, events["before"].Tags)
+	require.Equal(t, map[string]string{
+		"app_name": "test",
+		"network":  "home",
+	}, labelsToMap(events["before"].Labels))
+
+	// The metadata labels are kept.
+	require.Equal(t, []string{"profile:work", "vpn"}, events["after"].Tags)
+	require.Equal(t, map[string]string{
+		"app_name": "test",
+		"network":  "office",
+	}, labelsToMap(events["after"].Labels))
+}
@@ -0,0 +1,31 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+)
+
+const (
+	// The name of the event reported when a reporter is created.
+	startEventName = "reporter_start"
+	// The name of the event reported when a reporter is shut down.
+	shutdownEventName = "reporter_shutdown"
+)
+
+// reportLifecycleEvent reports a synthetic event describing the reporter
+// itself. It goes through the same filtering as any other event, and like
+// any other event, carries the library version unless it's omitted.
+func (r *Reporter) reportLifecycleEvent(name string) {
+	r.ReportEvent(&v1alpha1.TelemetryEvent{
+		Kind: v1alpha1.TelemetryEventKind_INFO,
+		Name: name,
+	})
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycleEvents(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:             baseURL,
+		Tags:                []string{"foo"},
+		EmitLifecycleEvents: true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Shutdown(ctx))
+
+	require.Len(t, svc.receivedEvents, 2)
+
+	// Events may be delivered in any order.
+	var names []string
+	for i := 0; i < 2; i++ {
+		event := <-svc.receivedEvents
+		names = append(names, event.Name)
+		require.Equal(t, r.SessionID(), event.SessionId)
+		require.Equal(t, []string{"foo"}, event.Tags)
+		require.NotEmpty(t, labelsToMap(event.Labels)["telemetry_version"])
+	}
+	require.ElementsMatch(t, []string{"reporter_start", "reporter_shutdown"}, names)
+}
+
+func TestLifecycleEventsOmitLibraryVersion(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:             baseURL,
+		EmitLifecycleEvents: true,
+		StateDir:            t.TempDir(),
+		OmitLibraryVersion:  true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Shutdown(ctx))
+
+	// Including the install event.
+	require.Len(t, svc.receivedEvents, 3)
+
+	for i := 0; i < 3; i++ {
+		event := <-svc.receivedEvents
+		require.NotContains(t, labelsToMap(event.Labels), "telemetry_version", event.Name)
+	}
+}
+
+func TestLifecycleEventsDisabled(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:             baseURL,
+		EmitLifecycleEvents: true,
+		SampleRate:          0.0000001,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	r.SetEnabled(false)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Shutdown(ctx))
+
+	// The start event is subject to sampling, and the shutdown event to the
+	// enabled flag.
+	require.Empty(t, svc.receivedEvents)
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// connRecyclingTransport closes the idle connections of a transport once
+// they've been open for longer than a maximum lifetime, so that subsequent
+// requests reconnect (eg. to a different instance behind a load balancer).
+// Connections in use are left alone, and recycled once idle.
+type connRecyclingTransport struct {
+	*http.Transport
+	clock       Clock
+	maxLifetime time.Duration
+	mu          sync.Mutex
+	since       time.Time
+}
+
+func newConnRecyclingTransport(clock Clock, transport *http.Transport, maxLifetime time.Duration) *connRecyclingTransport {
+	return &connRecyclingTransport{
+		Transport:   transport,
+		clock:       clock,
+		maxLifetime: maxLifetime,
+		since:       clock.Now(),
+	}
+}
+
+func (t *connRecyclingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	now := t.clock.Now()
+	recycle := now.Sub(t.since) >= t.maxLifetime
+	if recycle {
+		t.since = now
+	}
+	t.mu.Unlock()
+
+	if recycle {
+		t.CloseIdleConnections()
+	}
+
+	return t.Transport.RoundTrip(req)
+}
@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// LogAttrKey is the key of the attribute that marks log records to be
+// mirrored as telemetry events, eg.
+//
+//	logger.Warn("connect_failed", telemetry.LogAttrKey, true)
+const LogAttrKey = "telemetry"
+
+var _ slog.Handler = (*logHandler)(nil)
+
+// logHandler is a slog.Handler that mirrors marked records as telemetry
+// events.
+type logHandler struct {
+	inner    slog.Handler
+	reporter *Reporter
+	// The attributes added with WithAttrs, flattened into event values.
+	values map[string]string
+	// The prefix of the keys of subsequent attributes, from WithGroup.
+	prefix string
+	// Whether all records are mirrored, ie. the marker attribute was added
+	// with WithAttrs.
+	mirror bool
+}
+
+// NewLogHandler returns a slog.Handler that passes every record through to
+// the inner handler unchanged, and additionally reports records carrying the
+// attribute LogAttrKey=true as telemetry events. The record's message is the
+// event name, its level the event kind, and its attributes (including those
+// added with Logger.With) the event values, with the keys of grouped
+// attributes joined by ".". Only records enabled by the inner handler are
+// reported.
+func NewLogHandler(inner slog.Handler, reporter *Reporter) slog.Handler {
+	return &logHandler{
+		inner:    inner,
+		reporter: reporter,
+	}
+}
+
+func (h *logHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level)
+}
+
+func (h *logHandler) Handle(ctx context.Context, record slog.Record) error {
+	err := h.inner.Handle(ctx, record)
+
+	mirror := h.mirror
+	values := maps.Clone(h.values)
+	if values == nil {
+		values = make(map[string]string, record.NumAttrs())
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		if h.prefix == "" && isLogAttr(attr) {
+			mirror = true
+			return true
+		}
+
+		addLogAttr(values, h.prefix, attr)
+		return true
+	})
+
+	if !mirror {
+		return err
+	}
+
+	event := &v1alpha1.TelemetryEvent{
+		Kind: logEventKind(record.Level),
+		Name: record.Message,
+	}
+	if !record.Time.IsZero() {
+		event.Timestamp = timestamppb.New(record.Time)
+	}
+	if len(values) > 0 {
+		event.Values = values
+	}
+
+	h.reporter.ReportEventContext(ctx, event)
+
+	return err
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	h2 := *h
+	h2.inner = h.inner.WithAttrs(attrs)
+	h2.values = maps.Clone(h.values)
+	if h2.values == nil {
+		h2.values = make(map[string]string, len(attrs))
+	}
+	for _, attr := range attrs {
+		if h.prefix == "" && isLogAttr(attr) {
+			h2.mirror = true
+			continue
+		}
+
+		addLogAttr(h2.values, h.prefix, attr)
+	}
+
+	return &h2
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	h2 := *h
+	h2.inner = h.inner.WithGroup(name)
+	h2.prefix = h.prefix + name + "."
+
+	return &h2
+}
+
+// isLogAttr returns true if the attribute marks a record to be mirrored.
+func isLogAttr(attr slog.Attr) bool {
+	value := attr.Value.Resolve()
+	return attr.Key == LogAttrKey && value.Kind() == slog.KindBool && value.Bool()
+}
+
+// addLogAttr adds an attribute to the event values, flattening groups.
+func addLogAttr(values map[string]string, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		// Groups without a key are inlined.
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			addLogAttr(values, prefix, member)
+		}
+		return
+	}
+
+	values[prefix+attr.Key] = attr.Value.String()
+}
+
+// logEventKind maps a log level onto the equivalent event kind.
+func logEventKind(level slog.Level) v1alpha1.TelemetryEventKind {
+	switch {
+	case level >= slog.LevelError:
+		return v1alpha1.TelemetryEventKind_ERROR
+	case level >= slog.LevelWarn:
+		return v1alpha1.TelemetryEventKind_WARNING
+	default:
+		return v1alpha1.TelemetryEventKind_INFO
+	}
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogHandler(t *testing.T) {
+	ctx := context.Background()
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, slogt.New(t), telemetry.Configuration{
+		BaseURL: baseURL,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	var buf bytes.Buffer
+	inner := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	})
+
+	logger := slog.New(telemetry.NewLogHandler(inner, r)).With("component", "dialer")
+
+	logger.Info("connecting", "address", "example.com")
+	logger.WithGroup("retry").Warn("connect_failed",
+		telemetry.LogAttrKey, true, "attempt", 3)
+	require.NoError(t, r.Flush(ctx))
+
+	// Every record is passed through unchanged.
+	require.Equal(t, []string{
+		`level=INFO msg=connecting component=dialer address=example.com`,
+		`level=WARN msg=connect_failed component=dialer retry.telemetry=true retry.attempt=3`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+
+	// The marker attribute is only recognized outside of groups.
+	require.Empty(t, svc.receivedEvents)
+
+	logger.Warn("connect_failed", telemetry.LogAttrKey, true,
+		slog.Group("retry", "attempt", 3))
+	require.NoError(t, r.Flush(ctx))
+
+	ev := <-svc.receivedEvents
+	require.Equal(t, "connect_failed", ev.Name)
+	require.Equal(t, v1alpha1.TelemetryEventKind_WARNING, ev.Kind)
+	require.Equal(t, map[string]string{
+		"component":     "dialer",
+		"retry.attempt": "3",
+	}, ev.Values)
+	require.NotNil(t, ev.Timestamp)
+
+	// Loggers can mirror every record.
+	logger.With(telemetry.LogAttrKey, true).Error("disconnected")
+	require.NoError(t, r.Flush(ctx))
+
+	ev = <-svc.receivedEvents
+	require.Equal(t, "disconnected", ev.Name)
+	require.Equal(t, v1alpha1.TelemetryEventKind_ERROR, ev.Kind)
+}
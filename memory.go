@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"sync"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ReporterInterface is the subset of Reporter methods used to emit telemetry.
+// It allows the Reporter to be swapped out, eg. for a MemoryReporter in tests.
+type ReporterInterface interface {
+	// ReportEvent reports a telemetry event.
+	ReportEvent(event *v1alpha1.TelemetryEvent)
+	// ReportEventContext reports a telemetry event, respecting cancellation
+	// of ctx.
+	ReportEventContext(ctx context.Context, event *v1alpha1.TelemetryEvent)
+	// Flush blocks until all pending events have been reported.
+	Flush(ctx context.Context) error
+	// Shutdown gracefully shuts down the reporter.
+	Shutdown(ctx context.Context) error
+	// Close aborts any ongoing reporting.
+	Close() error
+}
+
+var (
+	_ ReporterInterface = (*Reporter)(nil)
+	_ ReporterInterface = (*MemoryReporter)(nil)
+)
+
+// MemoryReporter is a ReporterInterface that records events in memory, it's
+// intended for testing code that emits telemetry.
+type MemoryReporter struct {
+	mu     sync.Mutex
+	events []*v1alpha1.TelemetryEvent
+}
+
+// NewMemoryReporter creates a new in-memory reporter.
+func NewMemoryReporter() *MemoryReporter {
+	return &MemoryReporter{}
+}
+
+// ReportEvent records a telemetry event.
+func (r *MemoryReporter) ReportEvent(event *v1alpha1.TelemetryEvent) {
+	if event.Timestamp == nil {
+		event.Timestamp = timestamppb.Now()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+}
+
+// ReportEventContext records a telemetry event, unless ctx is already done.
+func (r *MemoryReporter) ReportEventContext(ctx context.Context, event *v1alpha1.TelemetryEvent) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	r.ReportEvent(event)
+}
+
+// Recorded returns the events recorded so far.
+func (r *MemoryReporter) Recorded() []*v1alpha1.TelemetryEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := make([]*v1alpha1.TelemetryEvent, len(r.events))
+	copy(events, r.events)
+
+	return events
+}
+
+// Flush is a no-op.
+func (r *MemoryReporter) Flush(_ context.Context) error {
+	return nil
+}
+
+// Shutdown is a no-op.
+func (r *MemoryReporter) Shutdown(_ context.Context) error {
+	return nil
+}
+
+// Close is a no-op.
+func (r *MemoryReporter) Close() error {
+	return nil
+}
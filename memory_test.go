@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryReporter(t *testing.T) {
+	var r telemetry.ReporterInterface = telemetry.NewMemoryReporter()
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "foo", Tags: []string{"bar"}})
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "baz"})
+
+	require.NoError(t, r.Flush(context.Background()))
+	require.NoError(t, r.Shutdown(context.Background()))
+
+	recorded := r.(*telemetry.MemoryReporter).Recorded()
+	require.Len(t, recorded, 2)
+	require.Equal(t, "foo", recorded[0].Name)
+	require.Equal(t, []string{"bar"}, recorded[0].Tags)
+	require.NotNil(t, recorded[0].Timestamp)
+	require.Equal(t, "baz", recorded[1].Name)
+}
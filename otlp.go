@@ -0,0 +1,365 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The path logs are exported to, relative to the OTLP/HTTP endpoint.
+const otlpLogsPath = "/v1/logs"
+
+// OTLP severity numbers, see:
+// https://opentelemetry.io/docs/specs/otel/logs/data-model/#field-severitynumber
+const (
+	otlpSeverityInfo  = 9
+	otlpSeverityWarn  = 13
+	otlpSeverityError = 17
+)
+
+var _ BatchSink = (*otlpSink)(nil)
+
+// otlpSink sends events as logs to an OpenTelemetry collector, using
+// OTLP/HTTP with JSON encoding.
+type otlpSink struct {
+	clock      Clock
+	url        string
+	client     *http.Client
+	setHeaders func(ctx context.Context, header http.Header) error
+}
+
+// NewOTLPSink creates a sink that sends events as OTLP logs to an
+// OpenTelemetry collector over OTLP/HTTP, eg. to use with an existing
+// observability pipeline. The endpoint is the base URL of the collector, eg.
+// "http://localhost:4318", logs are sent to its /v1/logs path. Uses
+// http.DefaultClient if httpClient is nil.
+//
+// Each event becomes a log record, with the message as the body, the kind as
+// the severity, and the rest as attributes: labels keep their keys, tags are
+// a string array attribute named "tags", and values are prefixed with
+// "value.".
+func NewOTLPSink(endpoint string, httpClient *http.Client) BatchSink {
+	return newOTLPSink(systemClock{}, endpoint, httpClient, nil)
+}
+
+func newOTLPSink(clock Clock, endpoint string, httpClient *http.Client, setHeaders func(ctx context.Context, header http.Header) error) *otlpSink {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &otlpSink{
+		clock:      clock,
+		url:        strings.TrimSuffix(endpoint, "/") + otlpLogsPath,
+		client:     httpClient,
+		setHeaders: setHeaders,
+	}
+}
+
+func (s *otlpSink) Send(ctx context.Context, event *v1alpha1.TelemetryEvent) error {
+	return s.SendBatch(ctx, []*v1alpha1.TelemetryEvent{event})
+}
+
+func (s *otlpSink) SendBatch(ctx context.Context, events []*v1alpha1.TelemetryEvent) error {
+	body, err := json.Marshal(otlpLogsRequestFor(events, s.clock.Now()))
+	if err != nil {
+		return connect.NewError(connect.CodeInternal, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	if s.setHeaders != nil {
+		if err := s.setHeaders(ctx, req.Header); err != nil {
+			return err
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return connect.NewError(connect.CodeUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	// Mapped onto connect errors, so that retries, the circuit breaker, and
+	// auth failure handling (and Retry-After) apply as usual.
+	connectErr := connect.NewError(otlpStatusCode(resp.StatusCode),
+		fmt.Errorf("OTLP export failed: %s", resp.Status))
+	for key, values := range resp.Header {
+		connectErr.Meta()[key] = values
+	}
+
+	return connectErr
+}
+
+// otlpStatusCode maps a HTTP status code onto the equivalent connect code.
+// Retryable statuses follow the OTLP/HTTP specification.
+func otlpStatusCode(status int) connect.Code {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return connect.CodeUnavailable
+	case http.StatusUnauthorized:
+		return connect.CodeUnauthenticated
+	case http.StatusForbidden:
+		return connect.CodePermissionDenied
+	case http.StatusNotFound:
+		return connect.CodeUnimplemented
+	default:
+		if status >= 500 {
+			return connect.CodeInternal
+		}
+
+		return connect.CodeInvalidArgument
+	}
+}
+
+// The OTLP/HTTP JSON encoding of an ExportLogsServiceRequest, see:
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string         `json:"timeUnixNano,omitempty"`
+	ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+	SeverityNumber       int            `json:"severityNumber"`
+	SeverityText         string         `json:"severityText"`
+	Body                 *otlpAnyValue  `json:"body,omitempty"`
+	Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string          `json:"stringValue,omitempty"`
+	BoolValue   *bool            `json:"boolValue,omitempty"`
+	IntValue    *string          `json:"intValue,omitempty"`
+	DoubleValue *float64         `json:"doubleValue,omitempty"`
+	ArrayValue  *otlpArrayValue  `json:"arrayValue,omitempty"`
+	KvlistValue *otlpKvlistValue `json:"kvlistValue,omitempty"`
+}
+
+type otlpArrayValue struct {
+	Values []otlpAnyValue `json:"values"`
+}
+
+type otlpKvlistValue struct {
+	Values []otlpKeyValue `json:"values"`
+}
+
+// otlpLogsRequestFor maps events onto OTLP log records.
+func otlpLogsRequestFor(events []*v1alpha1.TelemetryEvent, observed time.Time) *otlpLogsRequest {
+	records := make([]otlpLogRecord, 0, len(events))
+	for _, event := range events {
+		records = append(records, otlpLogRecordFor(event, observed))
+	}
+
+	return &otlpLogsRequest{
+		ResourceLogs: []otlpResourceLogs{{
+			ScopeLogs: []otlpScopeLogs{{
+				Scope:      otlpScope{Name: modulePath, Version: libraryVersion()},
+				LogRecords: records,
+			}},
+		}},
+	}
+}
+
+func otlpLogRecordFor(event *v1alpha1.TelemetryEvent, observed time.Time) otlpLogRecord {
+	record := otlpLogRecord{
+		ObservedTimeUnixNano: otlpTime(observed),
+	}
+
+	if event.Timestamp != nil {
+		record.TimeUnixNano = otlpTime(event.Timestamp.AsTime())
+	}
+
+	switch event.Kind {
+	case v1alpha1.TelemetryEventKind_WARNING:
+		record.SeverityNumber, record.SeverityText = otlpSeverityWarn, "WARN"
+	case v1alpha1.TelemetryEventKind_ERROR:
+		record.SeverityNumber, record.SeverityText = otlpSeverityError, "ERROR"
+	default:
+		record.SeverityNumber, record.SeverityText = otlpSeverityInfo, "INFO"
+	}
+
+	if event.Message != "" {
+		record.Body = otlpString(event.Message)
+	}
+
+	attr := func(key string, value *otlpAnyValue) {
+		record.Attributes = append(record.Attributes, otlpKeyValue{Key: key, Value: *value})
+	}
+
+	attr("event.name", otlpString(event.Name))
+	if event.SessionId != "" {
+		attr("session.id", otlpString(event.SessionId))
+	}
+	if event.PreviousSessionId != "" {
+		attr("session.previous_id", otlpString(event.PreviousSessionId))
+	}
+	if event.Sequence != 0 {
+		attr("event.sequence", otlpInt(int64(event.Sequence)))
+	}
+	if event.SchemaVersion != "" {
+		attr("schema.version", otlpString(event.SchemaVersion))
+	}
+	if event.DuplicateCount != 0 {
+		attr("event.duplicate_count", otlpInt(event.DuplicateCount))
+	}
+
+	for _, label := range event.Labels {
+		attr(label.Key, otlpString(label.Value))
+	}
+
+	if len(event.Tags) > 0 {
+		tags := make([]otlpAnyValue, len(event.Tags))
+		for i, tag := range event.Tags {
+			tags[i] = *otlpString(tag)
+		}
+		attr("tags", &otlpAnyValue{ArrayValue: &otlpArrayValue{Values: tags}})
+	}
+
+	keys := make([]string, 0, len(event.Values))
+	for key := range event.Values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		attr("value."+key, otlpString(event.Values[key]))
+	}
+
+	if len(event.StackTrace) > 0 {
+		var sb strings.Builder
+		for _, frame := range event.StackTrace {
+			fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		attr("exception.stacktrace", otlpString(sb.String()))
+	}
+
+	if event.Payload != nil {
+		attr("payload", otlpValue(structpb.NewStructValue(event.Payload)))
+	}
+
+	if event.Counter != nil {
+		attr("counter.value", otlpInt(event.Counter.Value))
+		if event.Counter.StartTime != nil {
+			attr("counter.start_time", otlpString(otlpTimestamp(event.Counter.StartTime)))
+		}
+	}
+
+	if event.Rollup != nil {
+		attr("rollup.count", otlpInt(event.Rollup.Count))
+		if event.Rollup.FirstSeen != nil {
+			attr("rollup.first_seen", otlpString(otlpTimestamp(event.Rollup.FirstSeen)))
+		}
+		if event.Rollup.LastSeen != nil {
+			attr("rollup.last_seen", otlpString(otlpTimestamp(event.Rollup.LastSeen)))
+		}
+	}
+
+	return record
+}
+
+// otlpValue converts a structured payload value.
+func otlpValue(value *structpb.Value) *otlpAnyValue {
+	switch kind := value.GetKind().(type) {
+	case *structpb.Value_StringValue:
+		return otlpString(kind.StringValue)
+	case *structpb.Value_BoolValue:
+		return &otlpAnyValue{BoolValue: &kind.BoolValue}
+	case *structpb.Value_NumberValue:
+		return &otlpAnyValue{DoubleValue: &kind.NumberValue}
+	case *structpb.Value_ListValue:
+		values := make([]otlpAnyValue, len(kind.ListValue.GetValues()))
+		for i, v := range kind.ListValue.GetValues() {
+			values[i] = *otlpValue(v)
+		}
+		return &otlpAnyValue{ArrayValue: &otlpArrayValue{Values: values}}
+	case *structpb.Value_StructValue:
+		fields := kind.StructValue.GetFields()
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		values := make([]otlpKeyValue, len(keys))
+		for i, key := range keys {
+			values[i] = otlpKeyValue{Key: key, Value: *otlpValue(fields[key])}
+		}
+		return &otlpAnyValue{KvlistValue: &otlpKvlistValue{Values: values}}
+	default:
+		// Null values are empty.
+		return &otlpAnyValue{}
+	}
+}
+
+func otlpString(s string) *otlpAnyValue {
+	return &otlpAnyValue{StringValue: &s}
+}
+
+// otlpInt encodes a 64-bit integer, as a string per the JSON encoding.
+func otlpInt(i int64) *otlpAnyValue {
+	s := strconv.FormatInt(i, 10)
+	return &otlpAnyValue{IntValue: &s}
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpTimestamp(ts *timestamppb.Timestamp) string {
+	return ts.AsTime().Format(time.RFC3339Nano)
+}
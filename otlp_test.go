@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOTLP(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	collector := startOTLPCollector(t)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		OTLPEndpoint: collector.URL,
+		AuthToken:    "token",
+		Tags:         []string{"beta"},
+		Labels: map[string]string{
+			"os": "linux",
+		},
+		OmitLibraryVersion: true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{
+		Name:    "test",
+		Kind:    v1alpha1.TelemetryEventKind_WARNING,
+		Message: "Hello, world!",
+		Tags:    []string{"cli"},
+		Labels: []*v1alpha1.Label{
+			{Key: "feature", Value: "foo"},
+		},
+		Values: map[string]string{"retries": "3"},
+	})
+	require.NoError(t, r.Flush(ctx))
+
+	requests := collector.received()
+	require.Len(t, requests, 1)
+
+	require.Equal(t, "Bearer token", requests[0].header.Get("Authorization"))
+	require.Equal(t, "application/json", requests[0].header.Get("Content-Type"))
+
+	scopeLogs := requests[0].body.ResourceLogs[0].ScopeLogs[0]
+	require.Equal(t, "github.com/noisysockets/telemetry", scopeLogs.Scope.Name)
+	require.Len(t, scopeLogs.LogRecords, 1)
+
+	record := scopeLogs.LogRecords[0]
+	require.Equal(t, 13, record.SeverityNumber)
+	require.Equal(t, "WARN", record.SeverityText)
+	require.Equal(t, "Hello, world!", record.Body.StringValue)
+	require.NotEmpty(t, record.TimeUnixNano)
+
+	attrs := make(map[string]otlpValue)
+	for _, attr := range record.Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+
+	require.Equal(t, "test", attrs["event.name"].StringValue)
+	require.Equal(t, r.SessionID(), attrs["session.id"].StringValue)
+	require.Equal(t, "1", attrs["event.sequence"].IntValue)
+
+	// Labels keep their keys.
+	require.Equal(t, "linux", attrs["os"].StringValue)
+	require.Equal(t, "foo", attrs["feature"].StringValue)
+
+	// Tags are a single array attribute.
+	require.NotNil(t, attrs["tags"].ArrayValue)
+	var tags []string
+	for _, tag := range attrs["tags"].ArrayValue.Values {
+		tags = append(tags, tag.StringValue)
+	}
+	require.ElementsMatch(t, []string{"beta", "cli"}, tags)
+
+	// Values are prefixed.
+	require.Equal(t, "3", attrs["value.retries"].StringValue)
+}
+
+func TestOTLPError(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	sink := telemetry.NewOTLPSink(srv.URL, nil)
+
+	err := sink.Send(ctx, &v1alpha1.TelemetryEvent{Name: "test"})
+	require.Error(t, err)
+	require.Equal(t, connect.CodeUnavailable, connect.CodeOf(err))
+
+	var connectErr *connect.Error
+	require.ErrorAs(t, err, &connectErr)
+	require.Equal(t, "1", connectErr.Meta().Get("Retry-After"))
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+	IntValue    string `json:"intValue"`
+	ArrayValue  *struct {
+		Values []otlpValue `json:"values"`
+	} `json:"arrayValue"`
+}
+
+type otlpLogsRequest struct {
+	ResourceLogs []struct {
+		ScopeLogs []struct {
+			Scope struct {
+				Name string `json:"name"`
+			} `json:"scope"`
+			LogRecords []struct {
+				TimeUnixNano   string    `json:"timeUnixNano"`
+				SeverityNumber int       `json:"severityNumber"`
+				SeverityText   string    `json:"severityText"`
+				Body           otlpValue `json:"body"`
+				Attributes     []struct {
+					Key   string    `json:"key"`
+					Value otlpValue `json:"value"`
+				} `json:"attributes"`
+			} `json:"logRecords"`
+		} `json:"scopeLogs"`
+	} `json:"resourceLogs"`
+}
+
+type otlpRequest struct {
+	header http.Header
+	body   otlpLogsRequest
+}
+
+type otlpCollector struct {
+	URL string
+
+	mu       sync.Mutex
+	requests []otlpRequest
+}
+
+// startOTLPCollector starts a fake OTLP/HTTP collector, recording the logs it
+// receives.
+func startOTLPCollector(t *testing.T) *otlpCollector {
+	c := &otlpCollector{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/logs" {
+			http.NotFound(w, req)
+			return
+		}
+
+		var body otlpLogsRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		c.mu.Lock()
+		c.requests = append(c.requests, otlpRequest{header: req.Header.Clone(), body: body})
+		c.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte("{}"))
+	}))
+	t.Cleanup(srv.Close)
+
+	c.URL = srv.URL
+
+	return c
+}
+
+func (c *otlpCollector) received() []otlpRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]otlpRequest(nil), c.requests...)
+}
@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// The name of the event reported when events are dropped due to overflow.
+	overflowEventName = "telemetry_overflow"
+	// The default minimum interval between overflow events.
+	defaultOverflowReportInterval = time.Minute
+)
+
+// overflowReporter counts events dropped due to overflow, and reports them at
+// most once per interval.
+type overflowReporter struct {
+	clock    Clock
+	interval time.Duration
+	report   func(dropped uint64, since time.Time)
+	mu       sync.Mutex
+	dropped  uint64
+	since    time.Time
+	last     time.Time
+	timer    Timer
+	stopped  bool
+	// Tracks reports that are underway.
+	reporting sync.WaitGroup
+}
+
+func newOverflowReporter(clock Clock, interval time.Duration, report func(dropped uint64, since time.Time)) *overflowReporter {
+	return &overflowReporter{
+		clock:    clock,
+		interval: interval,
+		report:   report,
+	}
+}
+
+// record counts dropped events, scheduling a report for as soon as the
+// interval allows.
+func (o *overflowReporter) record(dropped uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.stopped {
+		return
+	}
+
+	if o.dropped == 0 {
+		o.since = o.clock.Now()
+	}
+	o.dropped += dropped
+
+	if o.timer == nil {
+		delay := max(0, o.interval-o.clock.Now().Sub(o.last))
+		o.timer = o.clock.AfterFunc(delay, o.flush)
+	}
+}
+
+// flush reports the events dropped since the last report, unless the
+// reporter was stopped in the meantime.
+func (o *overflowReporter) flush() {
+	o.mu.Lock()
+	if o.stopped {
+		o.mu.Unlock()
+		return
+	}
+	dropped, since := o.take()
+	o.reporting.Add(1)
+	o.mu.Unlock()
+
+	defer o.reporting.Done()
+
+	if dropped > 0 {
+		o.report(dropped, since)
+	}
+}
+
+// take resets the count of dropped events, returning the previous count. The
+// caller must hold the lock.
+func (o *overflowReporter) take() (uint64, time.Time) {
+	dropped, since := o.dropped, o.since
+	o.dropped = 0
+	o.last = o.clock.Now()
+	o.timer = nil
+
+	return dropped, since
+}
+
+// stop cancels any scheduled report, optionally reporting any outstanding
+// dropped events immediately instead. It waits for any report that's already
+// underway.
+func (o *overflowReporter) stop(flush bool) {
+	o.mu.Lock()
+	o.stopped = true
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+	dropped, since := o.take()
+	o.mu.Unlock()
+
+	o.reporting.Wait()
+
+	if flush && dropped > 0 {
+		o.report(dropped, since)
+	}
+}
+
+// reportOverflow reports a synthetic event counting the events that were
+// dropped due to overflow. It skips all filtering, and bypasses the send queue
+// size limit, so that it isn't itself dropped.
+func (r *Reporter) reportOverflow(dropped uint64, since time.Time) {
+	if !r.enabled.Load() {
+		return
+	}
+
+	event := &v1alpha1.TelemetryEvent{
+		Kind: v1alpha1.TelemetryEventKind_WARNING,
+		Name: overflowEventName,
+		Counter: &v1alpha1.Counter{
+			Value:     int64(dropped),
+			StartTime: timestamppb.New(since),
+		},
+	}
+	r.stamp(event)
+
+	events := []*v1alpha1.TelemetryEvent{event}
+
+	r.inFlight.add()
+	if !r.queue.pushReserved(newPendingReport(r.reportsCtx, events)) {
+		r.inFlight.done()
+		r.spoolEvents(events)
+	}
+}
+
+// recordOverflow notes events dropped due to overflow, for reporting.
+func (r *Reporter) recordOverflow(dropped int) {
+	if r.overflow != nil {
+		r.overflow.record(uint64(dropped))
+	}
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// The longest the telemetry server can ask us to pause sending for.
+const maxRetryAfter = 10 * time.Minute
+
+// sendPause pauses sending while the telemetry server has asked us to back
+// off, eg. with a 429 Too Many Requests response and a Retry-After header.
+type sendPause struct {
+	clock Clock
+	mu    sync.Mutex
+	until time.Time
+}
+
+func newSendPause(clock Clock) *sendPause {
+	return &sendPause{clock: clock}
+}
+
+// pauseFor pauses sending for (at least) the given duration.
+func (p *sendPause) pauseFor(d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if until := p.clock.Now().Add(d); until.After(p.until) {
+		p.until = until
+	}
+}
+
+// pausedUntil returns when sending resumes, or the zero time if it's not
+// paused.
+func (p *sendPause) pausedUntil() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.clock.Now().Before(p.until) {
+		return time.Time{}
+	}
+
+	return p.until
+}
+
+// wait blocks while sending is paused, or until ctx is done.
+func (p *sendPause) wait(ctx context.Context) error {
+	for {
+		until := p.pausedUntil()
+		if until.IsZero() {
+			return nil
+		}
+
+		if err := sleep(ctx, p.clock, until.Sub(p.clock.Now())); err != nil {
+			return err
+		}
+	}
+}
+
+// retryAfter returns how long the telemetry server asked us to wait before
+// sending again, from the Retry-After header (in seconds, or as a HTTP date)
+// of a failed report, if any.
+func retryAfter(err error, now time.Time) (time.Duration, bool) {
+	var connectErr *connect.Error
+	if !errors.As(err, &connectErr) {
+		return 0, false
+	}
+
+	value := connectErr.Meta().Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	var d time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		d = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil {
+		d = t.Sub(now)
+	}
+
+	if d <= 0 {
+		return 0, false
+	}
+
+	return min(d, maxRetryAfter), true
+}
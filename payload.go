@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"fmt"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ReportEventWithPayload reports an informational event with the given name
+// and a structured payload. The payload may contain the types supported by
+// structpb.NewValue (eg. strings, numbers, bools, slices, and nested maps).
+//
+// The payload counts towards the maximum event size (see MaxEventBytes), so
+// keep it small, deeply nested payloads are discouraged. An error is returned
+// if the payload can't be converted, or the event is too large.
+func (r *Reporter) ReportEventWithPayload(name string, payload map[string]any) error {
+	s, err := structpb.NewStruct(payload)
+	if err != nil {
+		return fmt.Errorf("%w: invalid payload: %w", ErrInvalidEvent, err)
+	}
+
+	event := &v1alpha1.TelemetryEvent{
+		Kind:    v1alpha1.TelemetryEventKind_INFO,
+		Name:    name,
+		Payload: s,
+	}
+
+	if err := validateEvent(event, r.maxEventBytes, r.maxTags); err != nil {
+		return err
+	}
+
+	r.ReportEvent(event)
+
+	return nil
+}
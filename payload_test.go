@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReportEventWithPayload(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:       baseURL,
+		MaxEventBytes: 1024,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	payload := map[string]any{
+		"enabled": true,
+		"retries": 3.0,
+		"config": map[string]any{
+			"features": []any{"foo", "bar"},
+		},
+	}
+
+	require.NoError(t, r.ReportEventWithPayload("config_snapshot", payload))
+	require.NoError(t, r.Flush(ctx))
+
+	event := <-svc.receivedEvents
+	require.Equal(t, "config_snapshot", event.Name)
+	require.Equal(t, payload, event.Payload.AsMap())
+
+	// Unsupported types.
+	require.ErrorIs(t, r.ReportEventWithPayload("invalid", map[string]any{
+		"ch": make(chan int),
+	}), telemetry.ErrInvalidEvent)
+
+	// Too large.
+	require.ErrorIs(t, r.ReportEventWithPayload("large", map[string]any{
+		"data": strings.Repeat("a", 1024),
+	}), telemetry.ErrInvalidEvent)
+
+	require.NoError(t, r.Flush(ctx))
+	require.Empty(t, svc.receivedEvents)
+}
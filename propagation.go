@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"net/http"
+)
+
+// Propagator injects request-scoped context, eg. W3C trace context
+// (traceparent/tracestate), into the headers of each report.
+//
+// An OpenTelemetry TextMapPropagator can be adapted with:
+//
+//	telemetry.PropagatorFunc(func(ctx context.Context, header http.Header) {
+//		otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+//	})
+type Propagator interface {
+	// Inject sets any headers derived from ctx.
+	Inject(ctx context.Context, header http.Header)
+}
+
+// PropagatorFunc adapts an ordinary function to a Propagator.
+type PropagatorFunc func(ctx context.Context, header http.Header)
+
+// Inject calls f(ctx, header).
+func (f PropagatorFunc) Inject(ctx context.Context, header http.Header) {
+	f(ctx, header)
+}
+
+// noopPropagator is a Propagator that does nothing.
+type noopPropagator struct{}
+
+func (noopPropagator) Inject(_ context.Context, _ http.Header) {}
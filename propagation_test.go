@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1/v1alpha1connect"
+	"github.com/stretchr/testify/require"
+)
+
+type traceParentKey struct{}
+
+func TestPropagator(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(svc))
+
+	traceParents := make(chan string, 10)
+	baseURL := startHTTPServer(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		traceParents <- req.Header.Get("traceparent")
+		mux.ServeHTTP(w, req)
+	}))
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		Propagator: telemetry.PropagatorFunc(func(ctx context.Context, header http.Header) {
+			if traceParent, ok := ctx.Value(traceParentKey{}).(string); ok {
+				header.Set("traceparent", traceParent)
+			}
+		}),
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	r.ReportEventContext(context.WithValue(ctx, traceParentKey{}, traceParent), &v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	require.Equal(t, traceParent, <-traceParents)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	require.Empty(t, <-traceParents)
+}
@@ -0,0 +1,294 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/proto"
+)
+
+// OverflowPolicy determines what happens when a report is enqueued while the
+// send queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowDropNewest drops the report being enqueued.
+	OverflowDropNewest OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued report to make room.
+	OverflowDropOldest
+	// OverflowBlock blocks the caller until there is room in the queue.
+	OverflowBlock
+)
+
+// pendingReport is a report waiting to be sent.
+type pendingReport struct {
+	ctx    context.Context
+	events []*v1alpha1.TelemetryEvent
+	// The number of times the report has been retried from the retry queue.
+	requeues int
+	// The rank of the highest priority event in the report, see
+	// priorityRank.
+	priority int
+	// The serialized size of the events, in bytes.
+	size int
+}
+
+func newPendingReport(ctx context.Context, events []*v1alpha1.TelemetryEvent) *pendingReport {
+	size := 0
+	for _, event := range events {
+		size += proto.Size(event)
+	}
+
+	return &pendingReport{
+		ctx:      ctx,
+		events:   events,
+		priority: reportPriority(events),
+		size:     size,
+	}
+}
+
+// priorityRank orders event priorities from lowest to highest.
+func priorityRank(priority v1alpha1.TelemetryEventPriority) int {
+	switch priority {
+	case v1alpha1.TelemetryEventPriority_LOW:
+		return 0
+	case v1alpha1.TelemetryEventPriority_HIGH:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// reportPriority returns the rank of the highest priority event.
+func reportPriority(events []*v1alpha1.TelemetryEvent) int {
+	rank := priorityRank(v1alpha1.TelemetryEventPriority_LOW)
+	for _, event := range events {
+		rank = max(rank, priorityRank(event.Priority))
+	}
+
+	return rank
+}
+
+// sendQueue is a bounded FIFO queue of reports, drained by a pool of workers.
+// Its size bounds the number of pending reports, both queued and in-flight,
+// and optionally their total size in bytes.
+type sendQueue struct {
+	mu       sync.Mutex
+	size     int
+	maxBytes int
+	policy   OverflowPolicy
+	reports  []*pendingReport
+	pending  int
+	bytes    int
+	closed   bool
+	// Closed (and replaced) whenever the state of the queue changes.
+	changed chan struct{}
+}
+
+func newSendQueue(size, maxBytes int, policy OverflowPolicy) *sendQueue {
+	return &sendQueue{
+		size:     size,
+		maxBytes: maxBytes,
+		policy:   policy,
+		changed:  make(chan struct{}),
+	}
+}
+
+// push enqueues a report, applying the overflow policy if the queue is full.
+// It returns false if the report was dropped, and any older reports that were
+// evicted to make room for it. Regardless of the policy, queued reports of
+// lower priority are evicted in preference to dropping (or blocking on) a
+// higher priority report. If wait is set, it blocks until there is room (or
+// ctx is done) as with OverflowBlock, regardless of the policy.
+func (q *sendQueue) push(ctx context.Context, report *pendingReport, wait bool) (evicted []*pendingReport, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		if q.closed {
+			return nil, false
+		}
+
+		if q.hasRoom(q.pending, q.bytes, report.size) {
+			q.add(report)
+			return nil, true
+		}
+
+		if evicted := q.evict(report, q.policy == OverflowDropOldest && !wait); evicted != nil {
+			q.add(report)
+			return evicted, true
+		}
+
+		if q.policy != OverflowBlock && !wait {
+			return nil, false
+		}
+
+		changed := q.changed
+		q.mu.Unlock()
+
+		select {
+		case <-changed:
+			q.mu.Lock()
+		case <-ctx.Done():
+			q.mu.Lock()
+			return nil, false
+		}
+	}
+}
+
+// hasRoom returns true if a report of the given size fits alongside the
+// given number (and size) of pending reports. A report larger than the
+// maximum size still fits on its own, so that it isn't stuck forever.
+func (q *sendQueue) hasRoom(pending, bytes, size int) bool {
+	if pending >= q.size {
+		return false
+	}
+
+	return q.maxBytes <= 0 || pending == 0 || bytes+size <= q.maxBytes
+}
+
+// evict removes the oldest of the lowest priority queued reports, until
+// there is room for the given report, returning them. Only reports of lower
+// priority (or equal, if orEqual is set) are evicted, if that wouldn't make
+// enough room nothing is evicted and it returns nil. Reports that are already
+// in-flight can't be evicted. The caller must hold the lock.
+func (q *sendQueue) evict(report *pendingReport, orEqual bool) []*pendingReport {
+	var candidates []int
+	for i, queued := range q.reports {
+		if queued.priority < report.priority || (orEqual && queued.priority == report.priority) {
+			candidates = append(candidates, i)
+		}
+	}
+	// Lowest priority first, then oldest first.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return q.reports[candidates[i]].priority < q.reports[candidates[j]].priority
+	})
+
+	pending, bytes := q.pending, q.bytes
+	for n, i := range candidates {
+		pending--
+		bytes -= q.reports[i].size
+		if !q.hasRoom(pending, bytes, report.size) {
+			continue
+		}
+
+		evict := make(map[int]bool, n+1)
+		for _, i := range candidates[:n+1] {
+			evict[i] = true
+		}
+
+		var evicted []*pendingReport
+		remaining := q.reports[:0]
+		for i, queued := range q.reports {
+			if evict[i] {
+				evicted = append(evicted, queued)
+			} else {
+				remaining = append(remaining, queued)
+			}
+		}
+		clear(q.reports[len(remaining):])
+		q.reports = remaining
+		q.pending, q.bytes = pending, bytes
+
+		return evicted
+	}
+
+	return nil
+}
+
+// add appends a report to the queue. The caller must hold the lock.
+func (q *sendQueue) add(report *pendingReport) {
+	q.reports = append(q.reports, report)
+	q.pending++
+	q.bytes += report.size
+	q.notify()
+}
+
+// pushReserved enqueues a report that must not be dropped due to overflow,
+// regardless of the size of the queue. Callers are responsible for limiting
+// how often they do so. It returns false if the queue is closed.
+func (q *sendQueue) pushReserved(report *pendingReport) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+
+	q.add(report)
+
+	return true
+}
+
+// pop dequeues the oldest report, blocking until one is available. It returns
+// false once the queue has been closed and drained. Callers must call done
+// once they've finished with the report.
+func (q *sendQueue) pop() (*pendingReport, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.reports) == 0 {
+		if q.closed {
+			return nil, false
+		}
+
+		changed := q.changed
+		q.mu.Unlock()
+		<-changed
+		q.mu.Lock()
+	}
+
+	report := q.reports[0]
+	q.reports[0] = nil
+	q.reports = q.reports[1:]
+
+	return report, true
+}
+
+// done marks a popped report as finished, freeing up room in the queue.
+func (q *sendQueue) done(report *pendingReport) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.pending--
+	q.bytes -= report.size
+	q.notify()
+}
+
+// pendingBytes returns the total size of the pending reports, both queued and
+// in-flight.
+func (q *sendQueue) pendingBytes() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.bytes
+}
+
+// close stops accepting new reports, any queued reports will still be popped.
+func (q *sendQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		q.notify()
+	}
+}
+
+// notify wakes up anyone waiting for the state of the queue to change. The
+// caller must hold the lock.
+func (q *sendQueue) notify() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
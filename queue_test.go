@@ -0,0 +1,394 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/telemetrytest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverflowPolicy(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	t.Run("Drop Newest", func(t *testing.T) {
+		svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:   baseURL,
+			QueueSize: 2,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+		require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+		require.Equal(t, telemetry.StatusDroppedOverflow, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+
+		close(svc.release)
+
+		require.NoError(t, r.Flush(ctx))
+		require.Len(t, svc.receivedEvents, 2)
+	})
+
+	t.Run("Drop Oldest", func(t *testing.T) {
+		svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+		baseURL := startServer(t, svc)
+
+		// Larger than the number of workers, so that some reports are queued.
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:        baseURL,
+			QueueSize:      20,
+			OverflowPolicy: telemetry.OverflowDropOldest,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		for i := 0; i < 21; i++ {
+			require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+		}
+
+		close(svc.release)
+
+		require.NoError(t, r.Flush(ctx))
+		require.Len(t, svc.receivedEvents, 20)
+
+		stats := r.Stats()
+		require.Equal(t, uint64(21), stats.Accepted)
+		require.Equal(t, uint64(1), stats.DroppedOverflow)
+	})
+
+	t.Run("Block", func(t *testing.T) {
+		svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:        baseURL,
+			QueueSize:      1,
+			OverflowPolicy: telemetry.OverflowBlock,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+
+		// Blocking is bounded by the caller's context.
+		reportCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		t.Cleanup(cancel)
+
+		r.ReportEventContext(reportCtx, &v1alpha1.TelemetryEvent{Name: "test"})
+		require.Equal(t, uint64(1), r.Stats().DroppedOverflow)
+
+		result := make(chan telemetry.Status, 1)
+		go func() {
+			result <- r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"})
+		}()
+
+		select {
+		case <-result:
+			t.Fatal("expected report to block")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(svc.release)
+
+		require.Equal(t, telemetry.StatusAccepted, <-result)
+
+		require.NoError(t, r.Flush(ctx))
+		require.Len(t, svc.receivedEvents, 2)
+	})
+}
+
+func TestMaxConcurrentReports(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:              baseURL,
+		MaxConcurrentReports: 1,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+	require.Equal(t, telemetry.StatusDroppedOverflow, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+
+	close(svc.release)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Flush(ctx))
+	require.Len(t, svc.receivedEvents, 1)
+}
+
+func TestMaxInFlightBytes(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+	baseURL := startServer(t, svc)
+
+	// Room for two of the large events, well short of the count limit.
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:          baseURL,
+		MaxInFlightBytes: 10000,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	large := func() *v1alpha1.TelemetryEvent {
+		return &v1alpha1.TelemetryEvent{Name: "test", Message: strings.Repeat("a", 4000)}
+	}
+
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(large()))
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(large()))
+	require.Equal(t, telemetry.StatusDroppedOverflow, r.ReportEventResult(large()))
+
+	// Small events still fit.
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+
+	stats := r.Stats()
+	require.Greater(t, stats.InFlightBytes, uint64(8000))
+	require.LessOrEqual(t, stats.InFlightBytes, uint64(10000))
+
+	close(svc.release)
+
+	require.NoError(t, r.Flush(ctx))
+	require.Len(t, svc.receivedEvents, 3)
+
+	stats = r.Stats()
+	require.Equal(t, uint64(1), stats.DroppedOverflow)
+	require.Zero(t, stats.InFlightBytes)
+}
+
+func TestReportOverflow(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:                baseURL,
+		MaxConcurrentReports:   1,
+		ReportOverflow:         true,
+		OverflowReportInterval: time.Hour,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+	for i := 0; i < 5; i++ {
+		require.Equal(t, telemetry.StatusDroppedOverflow, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+	}
+
+	close(svc.release)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Shutdown(ctx))
+
+	var overflowEvents int
+	var dropped int64
+	for len(svc.receivedEvents) > 0 {
+		ev := <-svc.receivedEvents
+		if ev.Name == "telemetry_overflow" {
+			overflowEvents++
+			dropped += ev.Counter.Value
+		}
+	}
+
+	// Once when the first event was dropped, and once more on shutdown
+	// (as the interval hasn't elapsed).
+	require.LessOrEqual(t, overflowEvents, 2)
+	require.Equal(t, int64(5), dropped)
+	require.Equal(t, uint64(5), r.Stats().DroppedOverflow)
+}
+
+func TestReportOverflowClock(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+	baseURL := startServer(t, svc)
+
+	clock := telemetrytest.NewClock(time.Now())
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:                baseURL,
+		MaxConcurrentReports:   1,
+		ReportOverflow:         true,
+		OverflowReportInterval: time.Hour,
+		Clock:                  clock,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+
+	// The first drop is reported straight away, after which the next report
+	// is scheduled for when the interval has elapsed.
+	require.Eventually(t, func() bool {
+		require.Equal(t, telemetry.StatusDroppedOverflow, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+		return clock.Timers() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	clock.Advance(time.Hour)
+	close(svc.release)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	var dropped int64
+	for overflowEvents := 0; overflowEvents < 2; {
+		select {
+		case ev := <-svc.receivedEvents:
+			if ev.Name == "telemetry_overflow" {
+				overflowEvents++
+				dropped += ev.Counter.Value
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for overflow events")
+		}
+	}
+
+	require.Equal(t, int64(r.Stats().DroppedOverflow), dropped)
+}
+
+func TestPriorityEviction(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:              baseURL,
+		MaxConcurrentReports: 1,
+		QueueSize:            3,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, telemetry.StatusAccepted, r.ReportEventWithPriority(&v1alpha1.TelemetryEvent{
+			Name: "metric",
+		}, v1alpha1.TelemetryEventPriority_LOW))
+	}
+
+	// Low priority events can't displace each other.
+	require.Equal(t, telemetry.StatusDroppedOverflow, r.ReportEventWithPriority(&v1alpha1.TelemetryEvent{
+		Name: "metric",
+	}, v1alpha1.TelemetryEventPriority_LOW))
+
+	// But a high priority event displaces a queued low priority event.
+	event, err := telemetry.NewEvent("crash").
+		WithKind(v1alpha1.TelemetryEventKind_ERROR).
+		WithPriority(v1alpha1.TelemetryEventPriority_HIGH).
+		Build()
+	require.NoError(t, err)
+
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(event))
+
+	close(svc.release)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Flush(ctx))
+
+	var names []string
+	for len(svc.receivedEvents) > 0 {
+		names = append(names, (<-svc.receivedEvents).Name)
+	}
+	require.ElementsMatch(t, []string{"metric", "metric", "crash"}, names)
+
+	require.Equal(t, uint64(2), r.Stats().DroppedOverflow)
+}
+
+func TestReportEventWait(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:   baseURL,
+		QueueSize: 1,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.ReportEventWait(ctx, &v1alpha1.TelemetryEvent{Name: "test"}))
+
+	// ReportEvent still drops events when the queue is full.
+	require.Equal(t, telemetry.StatusDroppedOverflow, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+
+	// Waiting is bounded by the caller's context.
+	waitCtx, waitCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	t.Cleanup(waitCancel)
+
+	err := r.ReportEventWait(waitCtx, &v1alpha1.TelemetryEvent{Name: "test"})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	result := make(chan error, 1)
+	go func() {
+		result <- r.ReportEventWait(ctx, &v1alpha1.TelemetryEvent{Name: "test"})
+	}()
+
+	select {
+	case <-result:
+		t.Fatal("expected report to wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Unblocks once a slot frees up.
+	close(svc.release)
+
+	require.NoError(t, <-result)
+
+	require.NoError(t, r.Flush(ctx))
+	require.Len(t, svc.receivedEvents, 2)
+
+	require.Equal(t, uint64(2), r.Stats().DroppedOverflow)
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"regexp"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+)
+
+// Redactor rewrites a tag or label before it is sent, eg. to remove personally
+// identifiable information. Tags are passed with an empty key. It returns the
+// value to send in its place, or false to drop the tag or label entirely.
+type Redactor func(key, value string) (string, bool)
+
+// The replacement for redacted email addresses.
+const redactedEmail = "[email]"
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// Matches the home directory prefix of absolute paths on Linux, macOS,
+	// and Windows, eg. "/home/alice", "/Users/alice", and "C:\Users\alice".
+	homePathPattern = regexp.MustCompile(`(?:/home|/Users|[A-Za-z]:\\Users)[/\\][^/\\\s]+`)
+)
+
+// RedactPII is a Redactor that masks anything resembling an email address,
+// and replaces the home directory of absolute paths with "~" (so that the
+// username isn't sent).
+func RedactPII(_, value string) (string, bool) {
+	value = emailPattern.ReplaceAllString(value, redactedEmail)
+	value = homePathPattern.ReplaceAllString(value, "~")
+	return value, true
+}
+
+// redactTags applies the redactor to each tag, dropping those it rejects.
+func redactTags(redactor Redactor, tags []string) []string {
+	redacted := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag, ok := redactor("", tag); ok {
+			redacted = append(redacted, tag)
+		}
+	}
+
+	return redacted
+}
+
+// redactLabels applies the redactor to each label, dropping those it rejects.
+// The original labels are left untouched.
+func redactLabels(redactor Redactor, labels []*v1alpha1.Label) []*v1alpha1.Label {
+	redacted := make([]*v1alpha1.Label, 0, len(labels))
+	for _, label := range labels {
+		if value, ok := redactor(label.Key, label.Value); ok {
+			redacted = append(redacted, &v1alpha1.Label{Key: label.Key, Value: value})
+		}
+	}
+
+	return redacted
+}
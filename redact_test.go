@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactPII(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"connected", "connected"},
+		{"user alice@example.com logged in", "user [email] logged in"},
+		{"/home/alice/.config/nsh.yaml", "~/.config/nsh.yaml"},
+		{"/Users/alice/Library", "~/Library"},
+		{`C:\Users\alice\AppData`, `~\AppData`},
+		{"/etc/nsh/config.yaml", "/etc/nsh/config.yaml"},
+	}
+
+	for _, tt := range tests {
+		got, ok := telemetry.RedactPII("", tt.value)
+		require.True(t, ok)
+		require.Equal(t, tt.want, got)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		Tags:    []string{"/home/alice/nsh"},
+		Labels: map[string]string{
+			"user": "alice",
+		},
+		OmitLibraryVersion: true,
+		Redactor: func(key, value string) (string, bool) {
+			if key == "user" {
+				return "", false
+			}
+
+			return telemetry.RedactPII(key, value)
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{
+		Name: "test",
+		Tags: []string{"bob@example.com"},
+		Labels: []*v1alpha1.Label{
+			{Key: "config", Value: "/Users/bob/nsh.yaml"},
+		},
+	})
+	require.NoError(t, r.Flush(ctx))
+
+	ev := <-svc.receivedEvents
+	require.Equal(t, []string{"[email]", "~/nsh"}, ev.Tags)
+	require.Equal(t, map[string]string{
+		"config": "~/nsh.yaml",
+	}, labelsToMap(ev.Labels))
+}
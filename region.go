@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"log/slog"
+	"strings"
+)
+
+// The base URL of the collector used for unknown regions.
+const defaultRegionBaseURL = "https://telemetry.noisysockets.com"
+
+// The base URLs of the collectors in each region.
+var regionBaseURLs = map[string]string{
+	"us": "https://us.telemetry.noisysockets.com",
+	"eu": "https://eu.telemetry.noisysockets.com",
+	"ap": "https://ap.telemetry.noisysockets.com",
+}
+
+// regionBaseURL returns the base URL of the collector for the given region,
+// falling back to the default collector for unknown regions.
+func regionBaseURL(logger *slog.Logger, region string) string {
+	if baseURL, ok := regionBaseURLs[strings.ToLower(region)]; ok {
+		return baseURL
+	}
+
+	logger.Warn("Unknown telemetry region, using the default collector",
+		slog.String("region", region))
+
+	return defaultRegionBaseURL
+}
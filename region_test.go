@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegion(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for _, tc := range []struct {
+		name    string
+		conf    telemetry.Configuration
+		wantURL string
+	}{
+		{"Region", telemetry.Configuration{Region: "eu"}, "https://eu.telemetry.noisysockets.com"},
+		{"Case Insensitive", telemetry.Configuration{Region: "US"}, "https://us.telemetry.noisysockets.com"},
+		{"Unknown Region", telemetry.Configuration{Region: "mars"}, "https://telemetry.noisysockets.com"},
+		{"BaseURL Overrides Region", telemetry.Configuration{BaseURL: "https://telemetry.example.com", Region: "eu"}, "https://telemetry.example.com"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Records the requested URL without sending anything.
+			requested := make(chan string, 1)
+			tc.conf.HTTPClient = &http.Client{
+				Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					requested <- req.URL.Scheme + "://" + req.URL.Host
+					return nil, errors.New("not sent")
+				}),
+			}
+
+			r := telemetry.NewReporter(ctx, logger, tc.conf)
+			t.Cleanup(func() {
+				require.NoError(t, r.Close())
+			})
+
+			require.Error(t, r.Ping(ctx))
+			require.Equal(t, tc.wantURL, <-requested)
+		})
+	}
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
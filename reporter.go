@@ -13,162 +13,1958 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
-	_ "embed"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"connectrpc.com/connect"
 	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
 	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1/v1alpha1connect"
-	"github.com/noisysockets/telemetry/internal/util"
+	"github.com/noisysockets/telemetry/internal/compress"
+	"github.com/noisysockets/telemetry/internal/ratelimit"
+	"golang.org/x/net/http2"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-// The maximum number of in-flight telemetry reports.
-const maxConcurrentReports = 16
+// DefaultReportTimeout is the default maximum amount of time a single report
+// may take, including any retries.
+const DefaultReportTimeout = 30 * time.Second
 
-//go:embed roots.pem
-var rootsPEM []byte
+const (
+	// The default maximum number of in-flight telemetry reports.
+	defaultMaxConcurrentReports = 16
+	// The maximum amount of time a single request made by the default HTTP
+	// client may take.
+	defaultRequestTimeout = 5 * time.Second
+	// The default maximum amount of time to buffer events before flushing a
+	// partial batch.
+	defaultBatchInterval = 5 * time.Second
+	// The default maximum amount of time to wait for the tag function.
+	defaultTagFuncTimeout = 10 * time.Millisecond
+)
+
+const (
+	// CompressionGzip compresses requests using gzip.
+	CompressionGzip = "gzip"
+	// CompressionZstd compresses requests using zstd, which the telemetry
+	// server must support.
+	CompressionZstd = compress.Zstd
+	// CompressionNone sends requests uncompressed.
+	CompressionNone = "none"
+)
+
+const (
+	// CodecProto encodes requests using the binary protobuf codec.
+	CodecProto = "proto"
+	// CodecJSON encodes requests using the protobuf JSON mapping.
+	CodecJSON = "json"
+)
+
+const (
+	// ProtocolConnect uses the Connect protocol.
+	ProtocolConnect = "connect"
+	// ProtocolGRPC uses the gRPC protocol, which requires HTTP/2.
+	ProtocolGRPC = "grpc"
+	// ProtocolGRPCWeb uses the gRPC-Web protocol.
+	ProtocolGRPCWeb = "grpcweb"
+)
+
+// RateLimit is a token bucket rate limit for events.
+type RateLimit struct {
+	// Rate is the sustained number of events per second.
+	Rate float64
+	// Burst is the maximum number of events that can be reported in a burst.
+	// Defaults to the rate (rounded up), or 1, whichever is greater.
+	Burst int
+}
 
 // Configuration is the telemetry reporter configuration.
 type Configuration struct {
-	// BaseURL is the telemetry server base URL.
+	// BaseURL is the telemetry server base URL. It may also be a unix:// URL,
+	// eg. "unix:///run/telemetry.sock", to report to a local agent listening
+	// on a Unix domain socket (see UnixSocket). Takes precedence over Region.
 	BaseURL string
+	// Region selects the nearest telemetry collector, one of "us", "eu", or
+	// "ap", rather than specifying its BaseURL. Unknown regions use the
+	// default collector.
+	Region string
+	// UnixSocket is the optional path of a Unix domain socket to send reports
+	// over (using HTTP/2 over cleartext), eg. to a local agent that forwards
+	// them to the telemetry server. The BaseURL (and FallbackURLs) are still
+	// used for the request URLs and Host header. Ignored if HTTPClient is set.
+	UnixSocket string
+	// FallbackURLs is an optional list of telemetry server base URLs to try,
+	// in order, when the server at BaseURL is unreachable.
+	FallbackURLs []string
 	// AuthToken is the telemetry API auth bearer token.
 	AuthToken string
-	// Tags is a list of optional tags to include in all telemetry reports.
+	// AuthTokenFunc optionally obtains a fresh auth bearer token before each
+	// report, overriding AuthToken. Tokens are cached until shortly before
+	// the returned expiry, a zero expiry disables caching.
+	AuthTokenFunc func(ctx context.Context) (token string, expiry time.Time, err error)
+	// AuthFailureThreshold is the number of consecutive reports rejected due
+	// to authentication failures (or insufficient permissions, or failing to
+	// obtain a token with FailOnAuthTokenError) after which reporting is
+	// disabled (see DisabledByAuthFailure). Defaults to 3.
+	AuthFailureThreshold int
+	// FailOnAuthTokenError drops reports when AuthTokenFunc fails, rather than
+	// sending them without an Authorization header.
+	FailOnAuthTokenError bool
+	// Headers are optional additional headers to send with each report, eg.
+	// API keys required by a gateway. The User-Agent and Authorization (when
+	// AuthToken is set) headers take precedence.
+	Headers http.Header
+	// Tags is a list of optional tags to include in all telemetry reports,
+	// they can be replaced at runtime with Reporter.SetTags.
 	Tags []string
+	// TagFunc optionally returns additional tags to include in each report.
+	// It is called every time an event is reported (after the static Tags
+	// are applied) and should return quickly, eg. by reading from a cache.
+	// Only one call is made at a time. If it takes longer than the
+	// TagFuncTimeout, or a call is already in progress, the tags it last
+	// returned are used instead.
+	TagFunc func() []string
+	// TagFuncTimeout is the maximum amount of time to wait for TagFunc when
+	// reporting an event. Defaults to 10 milliseconds.
+	TagFuncTimeout time.Duration
+	// Labels is an optional set of key/value labels to include in all
+	// telemetry reports. Labels set on an event take precedence. They can be
+	// replaced at runtime with Reporter.SetLabels.
+	Labels map[string]string
+	// ContextExtractor optionally returns labels derived from the context
+	// passed to ReportEventContext, eg. a request id stored as a context
+	// value. Labels set on an event take precedence, and the extracted labels
+	// take precedence over the reporter level Labels.
+	ContextExtractor func(ctx context.Context) map[string]string
+	// Redactor is optionally applied to every tag and label (including the
+	// reporter level ones) before an event is sent, eg. RedactPII. Redaction
+	// happens client-side, before any network call (or write to the spool).
+	Redactor Redactor
+	// MaxDistinctLabelValues optionally limits the number of distinct values
+	// of each label key within the reporter's session (regardless of the
+	// session ids set on individual events), protecting the telemetry server
+	// from accidental high-cardinality labels (eg. a unique id). Once
+	// exceeded, further distinct values are replaced with
+	// OverflowLabelValue, and a warning is logged. Defaults to 0 (no limit).
+	MaxDistinctLabelValues int
+	// Interceptors are optionally applied, in order, around the sending of
+	// every event, see Interceptor.
+	Interceptors []Interceptor
+	// AppName is the name of the application, included in all telemetry
+	// reports as the "app_name" label.
+	AppName string
+	// AppVersion is the version of the application, included in all
+	// telemetry reports as the "app_version" label.
+	AppVersion string
+	// OmitLibraryVersion stops the version of this library from being
+	// included in all telemetry reports (as the "telemetry_version" label).
+	OmitLibraryVersion bool
+	// IncludeRuntimeInfo includes the operating system, architecture, Go
+	// version, and number of CPUs in all telemetry reports (as the
+	// "runtime_os", "runtime_arch", "runtime_go_version", and
+	// "runtime_num_cpu" labels). Nothing that could identify the host is
+	// included.
+	IncludeRuntimeInfo bool
+	// EnvironmentFingerprint optionally includes a hash of the hostname, a
+	// file, or a caller provided string in all telemetry reports (as the
+	// "environment_fingerprint" label). Disabled by default.
+	EnvironmentFingerprint EnvironmentFingerprint
+	// GeoHint is an optional coarse location (eg. a country or region code,
+	// resolved by the application) included in all telemetry reports as the
+	// "geo_hint" label. It's ignored (with a warning) if it looks like an IP
+	// address. The reporter never adds IP addresses itself, eg. with
+	// IncludeRuntimeInfo, but tags and labels supplied by the application are
+	// sent as is.
+	GeoHint string
 	// HTTPClient is the optional HTTP client to use for telemetry reporting.
 	HTTPClient *http.Client
+	// RootCAs is an optional pool of root certificates to trust when
+	// connecting to the telemetry server. Defaults to DefaultRootCAs (the
+	// Let's Encrypt roots). Ignored if HTTPClient is set.
+	RootCAs *x509.CertPool
+	// ClientCertificate is an optional certificate to present to the
+	// telemetry server, for servers that require mutual TLS. It's sent in
+	// addition to the AuthToken (if set). Ignored if HTTPClient is set.
+	ClientCertificate *tls.Certificate
+	// Proxy optionally returns the proxy to use for a given request. Defaults
+	// to http.ProxyFromEnvironment (eg. HTTPS_PROXY, NO_PROXY). Ignored if
+	// HTTPClient is set.
+	Proxy func(*http.Request) (*url.URL, error)
+	// DialContext optionally establishes connections to the telemetry server,
+	// eg. to egress from a specific local address. Ignored if HTTPClient is
+	// set.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// HTTP2ReadIdleTimeout is how long an HTTP/2 connection to the telemetry
+	// server may go without receiving any frames before it's health checked
+	// with a ping, so that connections silently dropped by NATs or firewalls
+	// are detected before the next report. Defaults to 30 seconds, set to a
+	// negative value to disable health checks. Ignored if HTTPClient is set.
+	HTTP2ReadIdleTimeout time.Duration
+	// HTTP2PingTimeout is how long to wait for a health check ping response
+	// before closing the connection. Defaults to 15 seconds. Ignored if
+	// HTTPClient is set.
+	HTTP2PingTimeout time.Duration
+	// ConnMaxLifetime optionally limits how long connections to the telemetry
+	// server are reused for, so that long-lived clients are periodically
+	// rebalanced across the instances behind a load balancer (which otherwise
+	// only sees new connections). Connections are closed, and replaced on
+	// the next report, once idle after the lifetime has elapsed. This bounds
+	// the HTTP/2 health checks, which would otherwise keep connections alive
+	// indefinitely. Defaults to 0 (no limit). Ignored if HTTPClient is set.
+	ConnMaxLifetime time.Duration
+	// BatchSize is the maximum number of events to include in a single
+	// telemetry report. Defaults to 1 (each event is reported individually).
+	BatchSize int
+	// BatchInterval is the maximum amount of time to buffer events before
+	// flushing a partial batch. Only used when BatchSize is greater than 1.
+	// Defaults to 5 seconds.
+	BatchInterval time.Duration
+	// MinReportInterval is the minimum interval between reports. Events
+	// reported in between are buffered, and coalesced into a single report
+	// (though Flush and Shutdown report them immediately). Defaults to 0 (no
+	// minimum interval).
+	MinReportInterval time.Duration
+	// ThrottleBufferSize is the maximum number of events buffered between
+	// reports when MinReportInterval is set, once full the oldest events are
+	// dropped. Defaults to 1000.
+	ThrottleBufferSize int
+	// MaxConcurrentReports is the maximum number of in-flight reports.
+	// Defaults to 16.
+	MaxConcurrentReports int
+	// QueueSize is the maximum number of pending reports (queued or
+	// in-flight). Defaults to MaxConcurrentReports.
+	QueueSize int
+	// ReportDisabledDrops enables reporting a
+	// "telemetry_dropped_while_disabled" event when reporting is re-enabled
+	// with SetEnabled, counting the events that were dropped while it was
+	// disabled (the events themselves are never sent). The count is always
+	// available through Stats (as DroppedDisabled).
+	ReportDisabledDrops bool
+	// ReportOverflow enables reporting a "telemetry_overflow" event, counting
+	// the events dropped due to overflow (of the send queue or the batch
+	// buffer), so that client-side loss is visible to the server. It bypasses
+	// the send queue size limit so it isn't itself dropped.
+	ReportOverflow bool
+	// OverflowReportInterval is the minimum interval between overflow events.
+	// Defaults to 1 minute.
+	OverflowReportInterval time.Duration
+	// OverflowPolicy determines what happens to reports when the queue is
+	// full. Defaults to OverflowDropNewest.
+	OverflowPolicy OverflowPolicy
+	// MaxInFlightBytes optionally limits the total serialized size of the
+	// pending reports (both queued and in-flight), in addition to their
+	// number, eg. to bound memory use on constrained clients. When exceeded
+	// the OverflowPolicy applies, as when the queue is full. A single report
+	// larger than the limit is still sent on its own. Defaults to no limit.
+	MaxInFlightBytes int
+	// MaxRetries is the maximum number of times to retry a failed report.
+	// Permanent errors (eg. authentication failures) are never retried.
+	// Defaults to 0 (no retries).
+	MaxRetries int
+	// RetryBackoff is the base delay between retries, which grows
+	// exponentially with each attempt. Defaults to 500 milliseconds.
+	RetryBackoff time.Duration
+	// RetryQueueSize is the maximum number of failed reports to hold in
+	// memory, to be retried later (with exponential backoff, starting at
+	// RetryBackoff) after any immediate retries are exhausted. Reports are
+	// retried up to 5 times before being dropped. The retry queue is drained
+	// on Shutdown, and discarded on Close (though Flush doesn't wait for it).
+	// Defaults to 0 (disabled).
+	RetryQueueSize int
+	// SpoolDir is an optional directory in which to persist events that could
+	// not be sent. Spooled events are replayed when the next reporter is
+	// created.
+	SpoolDir string
+	// StateDir is the optional directory used to record that a reporter has
+	// run before. When set, an "install" event is reported the first time a
+	// reporter is created (subject to consent, sampling, etc.), see
+	// Reporter.IsFirstRun.
+	StateDir string
+	// SpoolMaxBytes is the maximum size of the spool directory, once full the
+	// oldest events are discarded. Defaults to 1 MiB.
+	SpoolMaxBytes int64
+	// DrainSpoolOnShutdown makes Shutdown attempt to report any spooled events
+	// (after the pending reports) before returning. Events that can't be
+	// reported before the shutdown context expires are left on the spool.
+	DrainSpoolOnShutdown bool
+	// SampleRate is the fraction of events to report, between 0 and 1. The
+	// sampling decision is consistent for events of the same name within a
+	// session. Defaults to 1 (all events are reported).
+	SampleRate float64
+	// MaxEventBytes is the maximum serialized size of an event. The largest
+	// tag and label values of larger events are truncated (marked with an
+	// ellipsis) until they fit, if they still don't fit they are dropped.
+	// Defaults to DefaultMaxEventBytes.
+	MaxEventBytes int
+	// MaxTags is the maximum number of tags on an event (including the
+	// reporter level tags), events with more tags are dropped. Defaults to
+	// DefaultMaxTags.
+	MaxTags int
+	// DedupWindow enables deduplication of identical events (ignoring their
+	// timestamps). Identical events reported within the window of the event
+	// last being reported are suppressed, and the number suppressed is
+	// attached to the next reported occurrence, or reported on Flush/Shutdown.
+	// Defaults to 0 (disabled).
+	DedupWindow time.Duration
+	// RollupWindow enables merging identical events (ignoring their
+	// timestamps) reported within a window into a single event, reported
+	// when the window closes (or on Flush/Shutdown) with the number of
+	// occurrences and when the first and last were seen attached. Unlike
+	// deduplication, totals are preserved. Important events are never merged.
+	// Each occurrence is subject to sampling, rate limiting, and the
+	// interceptors as usual before being merged. Defaults to 0 (disabled).
+	RollupWindow time.Duration
+	// CounterInterval is how often the counters accumulated with
+	// IncrementCounter are reported. Defaults to 1 minute.
+	CounterInterval time.Duration
+	// FlushInterval optionally flushes buffered events (eg. partial batches
+	// and suppressed duplicates) at least this often, regardless of how often
+	// new events arrive, bounding how long any event may be held back.
+	// Defaults to 0 (disabled).
+	FlushInterval time.Duration
+	// RateLimits is an optional map of rate limits, keyed by event name (or
+	// the key returned by RateLimitKey). Events without a rate limit are
+	// unlimited.
+	RateLimits map[string]RateLimit
+	// RateLimitKey optionally returns the key used to look up the rate limit
+	// for an event. Defaults to the event name.
+	RateLimitKey func(event *v1alpha1.TelemetryEvent) string
+	// OptOutEnvVar is the environment variable that, when set, disables
+	// telemetry reporting. Defaults to NSH_NO_TELEMETRY. Telemetry is also
+	// disabled if DO_NOT_TRACK=1 is set.
+	OptOutEnvVar string
+	// ConsentFile is the optional path to a file recording the user's consent
+	// to telemetry, eg. "true" or "false" (also "1"/"0", "yes"/"no", "on"/"off",
+	// and "opt-in"/"opt-out"). When the file exists and is recognized it takes
+	// precedence over the environment, explicitly calling SetEnabled takes
+	// precedence over both. See RefreshConsent.
+	ConsentFile string
+	// DisableInCI disables reporting when running in a continuous integration
+	// environment (see IsCI), to keep bot traffic out of product analytics.
+	// It takes precedence over the consent file.
+	DisableInCI bool
+	// Compression is the algorithm used to compress requests, one of
+	// CompressionGzip, CompressionZstd, or CompressionNone. Defaults to
+	// CompressionGzip.
+	Compression string
+	// ReportTimeout is the maximum amount of time a single report may take,
+	// including any retries. Defaults to DefaultReportTimeout. Each request
+	// made by the default HTTP client is additionally limited to 5 seconds
+	// (or the report timeout, if shorter), so that a single stalled request
+	// doesn't consume the entire retry budget.
+	ReportTimeout time.Duration
+	// DefaultReportTimeout is the maximum amount of time a single report may
+	// take when the event is reported without a context deadline (see
+	// ReportEventContext). Defaults to ReportTimeout.
+	//
+	// The effective timeout of a report is the earliest of the deadline of
+	// the context passed to ReportEventContext, DefaultReportTimeout, and
+	// ReportTimeout, which is an absolute cap that can't be extended.
+	DefaultReportTimeout time.Duration
+	// SessionID optionally seeds the session id, eg. to carry a session across
+	// process restarts. Invalid ids (empty, longer than 128 characters, or
+	// containing whitespace or control characters) are replaced with a
+	// generated id.
+	SessionID string
+	// SessionTTL is the maximum lifetime of a session, after which a new
+	// session id is generated. Defaults to 0 (sessions never expire).
+	SessionTTL time.Duration
+	// StableIDSeed optionally derives a stable session id from a machine
+	// identifier, so that the same machine reports the same id across
+	// restarts. The seed is salted and hashed, so it's never sent as is.
+	// Ignored if SessionID is set, and disables SessionTTL.
+	StableIDSeed string
+	// FailureThreshold is the number of consecutive failed reports after which
+	// reporting is paused (events are dropped) for the cooldown period, after
+	// which a single probe event is reported to check if the server has
+	// recovered. Defaults to 0 (never pause reporting).
+	FailureThreshold int
+	// CooldownPeriod is the amount of time to pause reporting for after the
+	// failure threshold is reached. Defaults to 1 minute.
+	CooldownPeriod time.Duration
+	// Clock is the source of the current time, eg. for timestamping events,
+	// and schedules timers, eg. for retry backoff. Defaults to the system
+	// clock.
+	Clock Clock
+	// EmitLifecycleEvents enables reporting of a "reporter_start" event when
+	// the reporter is created, and a "reporter_shutdown" event when it's shut
+	// down. The events carry the session ID, configured tags, and the library
+	// version.
+	EmitLifecycleEvents bool
+	// Protocol is the RPC protocol to use, one of ProtocolConnect,
+	// ProtocolGRPC, or ProtocolGRPCWeb. Defaults to ProtocolConnect. Note that
+	// gRPC requires HTTP/2, a custom HTTPClient must support it (eg. h2c for
+	// plaintext servers).
+	Protocol string
+	// Codec is the codec used to encode requests, one of CodecProto or
+	// CodecJSON. Defaults to CodecProto.
+	Codec string
+	// ConnectOptions are optional additional options for the connect client
+	// used to report to the telemetry server, eg. connect.WithInterceptors.
+	// They're applied after those derived from Compression, Protocol, and
+	// Codec, and so take precedence where they conflict.
+	ConnectOptions []connect.ClientOption
+	// Streaming reports events over a long-lived client stream to the
+	// telemetry server, rather than a request per event or batch, for high
+	// throughput. Events are only confirmed as received when the stream is
+	// closed, which happens periodically, and on Flush or Shutdown, and only
+	// then are they counted as delivered, passed to OnSuccess, and audited
+	// (or if the server rejects them, passed to OnError). Falls
+	// back to unary requests if the server doesn't support streaming. Has no
+	// effect with a custom Sink. Note that the default HTTP client has no
+	// overall request timeout when streaming, as streams are long-lived.
+	Streaming bool
+	// Propagator injects request-scoped context (eg. trace context) from the
+	// context passed to ReportEventContext into each report's headers.
+	// Defaults to a no-op.
+	Propagator Propagator
+	// OnError is called for each event that ultimately fails to be reported
+	// (after any retries), or is dropped as invalid (eg. too large). It may be
+	// called from a background goroutine and must not block. Authentication
+	// failures are passed as an *AuthError.
+	OnError func(event *v1alpha1.TelemetryEvent, err error)
+	// OnSuccess is called once for each event that is successfully reported
+	// (to every sink). It's called from a background goroutine and must
+	// return quickly, as it holds up further reports. It's not called for
+	// dry runs.
+	OnSuccess func(event *v1alpha1.TelemetryEvent)
+	// OnDrop is called for each event that is dropped rather than reported,
+	// with the reason, eg. to diagnose missing events. It may be called from
+	// a background goroutine and must not block. Events that fail to be
+	// reported are passed to OnError instead.
+	OnDrop func(event *v1alpha1.TelemetryEvent, reason DropReason)
+	// FailureLogLevel is the level at which send failures are logged, eg.
+	// slog.LevelWarn when diagnosing connectivity issues. A *slog.LevelVar can
+	// be used to change it at runtime. Defaults to slog.LevelDebug.
+	FailureLogLevel slog.Leveler
+	// StartupJitter delays the first report by a random duration in the range
+	// [0, StartupJitter), to avoid many clients reporting at once after a
+	// coordinated start. Events reported during the delay are held in the
+	// in-flight report slots (and the batch buffer if batching is enabled),
+	// once those are full further events are dropped. Defaults to no delay.
+	StartupJitter time.Duration
+	// Sink is an optional destination to report events to instead of the
+	// telemetry server, eg. a file. When set, the connection settings (eg.
+	// BaseURL, AuthToken, and HTTPClient) are ignored.
+	Sink Sink
+	// Sinks optionally reports each event to multiple sinks, keyed by name,
+	// instead of Sink. Each sink is retried independently, so a failing sink
+	// doesn't affect the others, and failures are passed to OnError as a
+	// *SinkError.
+	Sinks map[string]Sink
+	// OTLPEndpoint optionally sends events as logs to an OpenTelemetry
+	// collector, using OTLP/HTTP, instead of the telemetry server, eg.
+	// "http://localhost:4318". The connection settings (eg. AuthToken and
+	// HTTPClient) apply as usual. See NewOTLPSink for how events are mapped.
+	OTLPEndpoint string
+	// DryRun logs the serialized form of each event at Info level instead of
+	// sending it to the telemetry server, eg. to see what would be reported
+	// during development. Everything else (consent, sampling, batching, etc.)
+	// applies as usual.
+	DryRun bool
+	// AuditLog optionally receives a JSON line for each event successfully
+	// sent (to each sink), recording exactly what telemetry left the
+	// machine. Writes are serialized, and synced if the writer supports it
+	// (eg. an *os.File).
+	AuditLog io.Writer
+	// AuditFailures also records events that failed to be sent in the
+	// AuditLog (after any retries).
+	AuditFailures bool
+	// UserAgent is the User-Agent header to send with each report. Defaults
+	// to "noisysockets-telemetry/<version>".
+	UserAgent string
+	// SchemaVersion is the version of the event schema included in all
+	// telemetry reports, both on each event and as the
+	// "X-Telemetry-Schema-Version" header, so the server can handle clients
+	// of different versions. Defaults to DefaultSchemaVersion.
+	SchemaVersion string
+	// ServerTimestamp leaves the timestamp of events unset, so the server
+	// stamps them with the time they're received instead. This avoids
+	// polluting the data with skewed client clocks (common on embedded
+	// devices), at the cost of ordering granularity, as events sent in the
+	// same batch (or delayed by retries) share the receive time. Timestamps
+	// set explicitly on events are always kept.
+	ServerTimestamp bool
+	// VerifyOnStart pings the telemetry server (see Ping) when the reporter
+	// is created, so that misconfiguration is noticed immediately. Failures
+	// are returned by NewReporterWithVerify, and logged by NewReporter. As
+	// telemetry should rarely be fatal, this is best enabled behind a feature
+	// flag.
+	VerifyOnStart bool
+	// VerifyTimeout is the maximum amount of time VerifyOnStart may delay
+	// startup for. Defaults to 5 seconds.
+	VerifyTimeout time.Duration
 }
 
 // Reporter is a telemetry reporter.
 type Reporter struct {
-	logger       *slog.Logger
-	client       v1alpha1connect.TelemetryClient
-	authToken    string
-	sessionID    string
-	tags         []string
-	reportsCtx   context.Context
-	reports      *errgroup.Group
-	shuttingDown atomic.Bool
+	logger              *slog.Logger
+	clock               Clock
+	sinks               []namedSink
+	authToken           atomic.Pointer[string]
+	headers             http.Header
+	authTokens          *tokenSource
+	failOnAuthError     bool
+	maxAuthFailures     int
+	authFailures        atomic.Int64
+	authDisabled        atomic.Bool
+	userAgent           string
+	schemaVersion       string
+	serverTimestamp     bool
+	session             *session
+	attributes          atomic.Pointer[reporterAttributes]
+	tagFunc             *tagFunc
+	metadata            map[string]string
+	cardinality         *cardinalityGuard
+	enabled             atomic.Bool
+	disabledReason      atomic.Pointer[string]
+	reportDisabledDrops bool
+	disabledDrops       atomic.Uint64
+	disabledSince       atomic.Pointer[time.Time]
+	consentOverridden   atomic.Bool
+	consentFile         string
+	optOutEnvVar        string
+	disableInCI         bool
+	firstRun            bool
+	reportsCtx          context.Context
+	reports             *errgroup.Group
+	queue               *sendQueue
+	concurrency         int
+	drainSpool          bool
+	inFlight            inFlightReports
+	shuttingDown        atomic.Bool
+	shutdownOnce        sync.Once
+	shutdownDone        chan struct{}
+	shutdownErr         error
+	closeOnce           sync.Once
+	closeErr            error
+	batcher             *batcher
+	maxRetries          int
+	retryBackoff        time.Duration
+	spool               *spool
+	streamingSink       *connectSink
+	timeout             time.Duration
+	defaultTimeout      time.Duration
+	sampleRate          float64
+	stats               stats
+	pause               *sendPause
+	maxEventBytes       int
+	maxTags             int
+	dedup               *deduplicator
+	rollup              *rollupAggregator
+	rollupFlusher       *periodicFlusher
+	counters            *counterAggregator
+	flusher             *periodicFlusher
+	contextExtractor    func(ctx context.Context) map[string]string
+	redactor            Redactor
+	interceptors        []Interceptor
+	dryRun              bool
+	audit               *auditLog
+	overflow            *overflowReporter
+	throttle            *throttler
+	retries             *retryQueue
+	created             time.Time
+	limiter             *ratelimit.Limiter
+	breaker             *circuitBreaker
+	rateLimitKey        func(event *v1alpha1.TelemetryEvent) string
+	emitLifecycleEvents bool
+	propagator          Propagator
+	onError             func(event *v1alpha1.TelemetryEvent, err error)
+	onSuccess           func(event *v1alpha1.TelemetryEvent)
+	onDrop              func(event *v1alpha1.TelemetryEvent, reason DropReason)
+	failureLogLevel     slog.Leveler
+	startupDelay        *startupDelay
 }
 
-// NewReporter creates a new telemetry reporter.
+// NewReporter creates a new telemetry reporter. Canceling ctx tears down the
+// reporter, as if Close was called, so its lifetime can be managed purely
+// through ctx.
 func NewReporter(ctx context.Context, logger *slog.Logger, conf Configuration) *Reporter {
+	r := newReporter(ctx, logger, conf)
+
+	if conf.VerifyOnStart {
+		if err := r.verify(ctx, conf.VerifyTimeout); err != nil {
+			logger.Warn("Telemetry server is unreachable", slog.Any("error", err))
+		}
+	}
+
+	return r
+}
+
+func newReporter(ctx context.Context, logger *slog.Logger, conf Configuration) *Reporter {
+	timeout := conf.ReportTimeout
+	if timeout <= 0 {
+		timeout = DefaultReportTimeout
+	}
+
+	defaultTimeout := conf.DefaultReportTimeout
+	if defaultTimeout <= 0 || defaultTimeout > timeout {
+		defaultTimeout = timeout
+	}
+
+	clock := conf.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	baseURL, unixSocket := conf.BaseURL, conf.UnixSocket
+	if baseURL == "" && conf.Region != "" {
+		baseURL = regionBaseURL(logger, conf.Region)
+	}
+	if path, ok := unixSocketPath(baseURL); ok {
+		baseURL, unixSocket = unixSocketBaseURL, path
+	}
+
 	httpClient := conf.HTTPClient
+	if httpClient != nil && conf.DialContext != nil {
+		logger.Warn("Ignoring custom dialer as a custom HTTP client was supplied")
+	}
+	if httpClient != nil && unixSocket != "" {
+		logger.Warn("Ignoring Unix socket as a custom HTTP client was supplied")
+	}
+	if httpClient != nil && conf.ClientCertificate != nil {
+		logger.Warn("Ignoring client certificate as a custom HTTP client was supplied")
+	}
+
+	keepalive := newHTTP2Keepalive(conf.HTTP2ReadIdleTimeout, conf.HTTP2PingTimeout)
+
+	// Streams are long-lived, so individual reports are bounded by their
+	// context instead.
+	requestTimeout := min(defaultRequestTimeout, timeout)
+	if conf.Streaming {
+		requestTimeout = 0
+	}
+
+	if httpClient == nil && unixSocket != "" {
+		httpClient = &http.Client{
+			Timeout:   requestTimeout,
+			Transport: newUnixSocketTransport(unixSocket, keepalive),
+		}
+	}
+
 	if httpClient == nil {
-		// Only trust Let's Encrypt, eg. ISRG Root X1 (DST Root CA X3) and
-		// ISRG Root X2 (ISRG Root CA).
-		roots := x509.NewCertPool()
-		if ok := roots.AppendCertsFromPEM(rootsPEM); !ok {
-			panic("failed to parse roots.pem")
+		roots := conf.RootCAs
+		if roots == nil {
+			roots = DefaultRootCAs
+		}
+
+		tlsConfig := &tls.Config{
+			RootCAs: roots,
+		}
+		if conf.ClientCertificate != nil {
+			tlsConfig.Certificates = []tls.Certificate{*conf.ClientCertificate}
+		}
+
+		proxy := conf.Proxy
+		if proxy == nil {
+			proxy = http.ProxyFromEnvironment
+		}
+
+		transport := &http.Transport{
+			Proxy:           proxy,
+			DialContext:     conf.DialContext,
+			TLSClientConfig: tlsConfig,
+		}
+
+		// Enables HTTP/2 (which gRPC requires, and is otherwise disabled by
+		// the custom TLS config), so that we can configure health checks.
+		h2Transport, err := http2.ConfigureTransports(transport)
+		if err != nil {
+			logger.Warn("Failed to configure HTTP/2", slog.Any("error", err))
+			transport.ForceAttemptHTTP2 = true
+		} else {
+			keepalive.apply(h2Transport)
+		}
+
+		var roundTripper http.RoundTripper = transport
+		if conf.ConnMaxLifetime > 0 {
+			roundTripper = newConnRecyclingTransport(clock, transport, conf.ConnMaxLifetime)
 		}
 
 		httpClient = &http.Client{
-			Timeout: 5 * time.Second,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					RootCAs: roots,
-				},
-			},
+			Timeout:   requestTimeout,
+			Transport: roundTripper,
 		}
 	}
 
 	reports, reportsCtx := errgroup.WithContext(ctx)
-	reports.SetLimit(maxConcurrentReports)
 
-	return &Reporter{
-		logger:     logger,
-		client:     v1alpha1connect.NewTelemetryClient(httpClient, conf.BaseURL),
-		authToken:  conf.AuthToken,
-		sessionID:  util.GenerateID(16),
-		tags:       conf.Tags,
-		reportsCtx: reportsCtx,
-		reports:    reports,
+	maxConcurrentReports := conf.MaxConcurrentReports
+	if maxConcurrentReports < 0 {
+		logger.Warn("Invalid maximum number of concurrent reports, using the default",
+			slog.Int("maxConcurrentReports", maxConcurrentReports))
+	}
+	if maxConcurrentReports <= 0 {
+		maxConcurrentReports = defaultMaxConcurrentReports
+	}
+
+	queueSize := conf.QueueSize
+	if queueSize <= 0 {
+		queueSize = maxConcurrentReports
+	}
+
+	retryBackoff := conf.RetryBackoff
+	if retryBackoff <= 0 {
+		retryBackoff = defaultRetryBackoff
+	}
+
+	maxEventBytes := conf.MaxEventBytes
+	if maxEventBytes <= 0 {
+		maxEventBytes = DefaultMaxEventBytes
+	}
+
+	maxTags := conf.MaxTags
+	if maxTags <= 0 {
+		maxTags = DefaultMaxTags
+	}
+
+	sampleRate := conf.SampleRate
+	if sampleRate <= 0 || sampleRate > 1 {
+		sampleRate = 1
+	}
+
+	var clientOpts []connect.ClientOption
+	switch conf.Compression {
+	case "", CompressionGzip:
+		clientOpts = append(clientOpts, connect.WithSendCompression(CompressionGzip))
+	case CompressionZstd:
+		clientOpts = append(clientOpts,
+			connect.WithAcceptCompression(compress.Zstd, compress.NewZstdDecompressor, compress.NewZstdCompressor),
+			connect.WithSendCompression(CompressionZstd))
+	case CompressionNone:
+	default:
+		logger.Warn("Unsupported compression, falling back to gzip",
+			slog.String("compression", conf.Compression))
+		clientOpts = append(clientOpts, connect.WithSendCompression(CompressionGzip))
+	}
+
+	switch conf.Protocol {
+	case "", ProtocolConnect:
+	case ProtocolGRPC:
+		clientOpts = append(clientOpts, connect.WithGRPC())
+	case ProtocolGRPCWeb:
+		clientOpts = append(clientOpts, connect.WithGRPCWeb())
+	default:
+		logger.Warn("Unsupported protocol, falling back to connect",
+			slog.String("protocol", conf.Protocol))
 	}
+
+	switch conf.Codec {
+	case "", CodecProto:
+	case CodecJSON:
+		clientOpts = append(clientOpts, connect.WithProtoJSON())
+	default:
+		logger.Warn("Unsupported codec, falling back to proto",
+			slog.String("codec", conf.Codec))
+	}
+
+	clientOpts = append(clientOpts, conf.ConnectOptions...)
+
+	sessionID := conf.SessionID
+	if sessionID != "" && !validSessionID(sessionID) {
+		logger.Warn("Invalid session id, generating a new one")
+		sessionID = ""
+	}
+
+	sessionTTL := conf.SessionTTL
+	if sessionID == "" && conf.StableIDSeed != "" {
+		sessionID = stableSessionID(conf.StableIDSeed)
+		// Stable ids are never rotated.
+		sessionTTL = 0
+	}
+
+	labels := metadataLabels(logger, conf)
+	if conf.EnvironmentFingerprint.Source != FingerprintOff {
+		fingerprint, err := conf.EnvironmentFingerprint.fingerprint()
+		if err != nil {
+			logger.Warn("Failed to fingerprint environment", slog.Any("error", err))
+		} else {
+			labels[fingerprintLabelKey] = fingerprint
+		}
+	}
+
+	authFailureThreshold := conf.AuthFailureThreshold
+	if authFailureThreshold <= 0 {
+		authFailureThreshold = defaultAuthFailureThreshold
+	}
+
+	failureLogLevel := conf.FailureLogLevel
+	if failureLogLevel == nil {
+		failureLogLevel = slog.LevelDebug
+	}
+
+	propagator := conf.Propagator
+	if propagator == nil {
+		propagator = noopPropagator{}
+	}
+
+	userAgent := conf.UserAgent
+	if userAgent == "" {
+		userAgent = defaultUserAgent()
+	}
+
+	schemaVersion := conf.SchemaVersion
+	if schemaVersion == "" {
+		schemaVersion = DefaultSchemaVersion
+	}
+
+	r := &Reporter{
+		logger:              logger,
+		clock:               clock,
+		created:             clock.Now(),
+		headers:             conf.Headers.Clone(),
+		failOnAuthError:     conf.FailOnAuthTokenError,
+		maxAuthFailures:     authFailureThreshold,
+		userAgent:           userAgent,
+		schemaVersion:       schemaVersion,
+		serverTimestamp:     conf.ServerTimestamp,
+		session:             newSession(clock, sessionTTL, sessionID),
+		pause:               newSendPause(clock),
+		metadata:            labels,
+		consentFile:         conf.ConsentFile,
+		optOutEnvVar:        conf.OptOutEnvVar,
+		disableInCI:         conf.DisableInCI,
+		reportsCtx:          reportsCtx,
+		reports:             reports,
+		queue:               newSendQueue(queueSize, conf.MaxInFlightBytes, conf.OverflowPolicy),
+		shutdownDone:        make(chan struct{}),
+		concurrency:         maxConcurrentReports,
+		drainSpool:          conf.DrainSpoolOnShutdown,
+		maxRetries:          conf.MaxRetries,
+		retryBackoff:        retryBackoff,
+		timeout:             timeout,
+		defaultTimeout:      defaultTimeout,
+		contextExtractor:    conf.ContextExtractor,
+		redactor:            conf.Redactor,
+		interceptors:        conf.Interceptors,
+		dryRun:              conf.DryRun,
+		reportDisabledDrops: conf.ReportDisabledDrops,
+		sampleRate:          sampleRate,
+		maxEventBytes:       maxEventBytes,
+		maxTags:             maxTags,
+		emitLifecycleEvents: conf.EmitLifecycleEvents,
+		propagator:          propagator,
+		onError:             conf.OnError,
+		onSuccess:           conf.OnSuccess,
+		onDrop:              conf.OnDrop,
+		failureLogLevel:     failureLogLevel,
+	}
+	r.attributes.Store(&reporterAttributes{
+		tags:   slices.Clone(conf.Tags),
+		labels: r.withMetadata(conf.Labels),
+	})
+
+	for i := 0; i < maxConcurrentReports; i++ {
+		r.reports.Go(r.sendWorker)
+	}
+
+	if conf.AuthTokenFunc != nil {
+		r.authTokens = newTokenSource(clock, conf.AuthTokenFunc)
+	}
+
+	if conf.StartupJitter > 0 {
+		r.startupDelay = newStartupDelay(conf.StartupJitter)
+	}
+
+	if len(conf.RateLimits) > 0 {
+		limits := make(map[string]ratelimit.Limit, len(conf.RateLimits))
+		for key, limit := range conf.RateLimits {
+			limits[key] = ratelimit.Limit{Rate: limit.Rate, Burst: limit.Burst}
+		}
+
+		r.limiter = ratelimit.New(limits, clock.Now)
+
+		r.rateLimitKey = conf.RateLimitKey
+		if r.rateLimitKey == nil {
+			r.rateLimitKey = func(event *v1alpha1.TelemetryEvent) string {
+				return event.Name
+			}
+		}
+	}
+
+	r.enabled.Store(true)
+	r.authToken.Store(&conf.AuthToken)
+	if conf.DedupWindow > 0 {
+		r.dedup = newDeduplicator(clock, conf.DedupWindow)
+	}
+
+	if conf.TagFunc != nil {
+		tagFuncTimeout := conf.TagFuncTimeout
+		if tagFuncTimeout <= 0 {
+			tagFuncTimeout = defaultTagFuncTimeout
+		}
+
+		r.tagFunc = newTagFunc(logger, conf.TagFunc, tagFuncTimeout)
+	}
+
+	if conf.MaxDistinctLabelValues > 0 {
+		r.cardinality = newCardinalityGuard(logger, conf.MaxDistinctLabelValues)
+	}
+
+	if conf.FailureThreshold > 0 {
+		r.breaker = newCircuitBreaker(logger, clock, conf.FailureThreshold, conf.CooldownPeriod)
+	}
+
+	switch {
+	case len(conf.Sinks) > 0:
+		names := make([]string, 0, len(conf.Sinks))
+		for name := range conf.Sinks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			r.sinks = append(r.sinks, namedSink{name: name, Sink: conf.Sinks[name]})
+		}
+	case conf.Sink != nil:
+		r.sinks = []namedSink{{Sink: conf.Sink}}
+	case conf.OTLPEndpoint != "":
+		r.sinks = []namedSink{{Sink: newOTLPSink(r.clock, conf.OTLPEndpoint, httpClient, r.setHeaders)}}
+	default:
+		sink := &connectSink{setHeaders: r.setHeaders, settle: r.settleStreamed}
+		for _, baseURL := range append([]string{baseURL}, conf.FallbackURLs...) {
+			client := v1alpha1connect.NewTelemetryClient(httpClient, baseURL, clientOpts...)
+			sink.clients = append(sink.clients, client)
+			if conf.Streaming {
+				sink.streams = append(sink.streams, newEventStream(clock, client, r.setHeaders, r.settleStreamed))
+			}
+		}
+		r.sinks = []namedSink{{Sink: sink}}
+		if conf.Streaming {
+			r.streamingSink = sink
+		}
+	}
+
+	r.RefreshConsent()
+
+	if conf.SpoolDir != "" {
+		var err error
+		r.spool, err = newSpool(clock, conf.SpoolDir, conf.SpoolMaxBytes)
+		if err != nil {
+			logger.Warn("Failed to open spool, disabling", slog.Any("error", err))
+		}
+	}
+
+	counterInterval := conf.CounterInterval
+	if counterInterval <= 0 {
+		counterInterval = defaultCounterInterval
+	}
+
+	if conf.ReportOverflow {
+		overflowReportInterval := conf.OverflowReportInterval
+		if overflowReportInterval <= 0 {
+			overflowReportInterval = defaultOverflowReportInterval
+		}
+
+		r.overflow = newOverflowReporter(clock, overflowReportInterval, r.reportOverflow)
+	}
+
+	if conf.AuditLog != nil {
+		r.audit = newAuditLog(clock, conf.AuditLog, conf.AuditFailures)
+	}
+
+	r.counters = newCounterAggregator(clock)
+	go r.counters.run(reportsCtx, counterInterval, r.flushCounters)
+
+	if conf.RetryQueueSize > 0 {
+		r.retries = newRetryQueue(clock, conf.RetryQueueSize, retryBackoff, r.resend)
+	}
+
+	if conf.MinReportInterval > 0 {
+		throttleBufferSize := conf.ThrottleBufferSize
+		if throttleBufferSize <= 0 {
+			throttleBufferSize = defaultThrottleBufferSize
+		}
+
+		r.throttle = newThrottler(reportsCtx, throttleBufferSize, conf.MinReportInterval, r.sendThrottled)
+	}
+
+	if conf.BatchSize > 1 {
+		batchInterval := conf.BatchInterval
+		if batchInterval <= 0 {
+			batchInterval = defaultBatchInterval
+		}
+
+		r.batcher = newBatcher(reportsCtx, conf.BatchSize, maxConcurrentReports, batchInterval, r.sendBatch)
+	}
+
+	if conf.FlushInterval > 0 {
+		r.flusher = newPeriodicFlusher()
+		go r.flusher.run(reportsCtx, conf.FlushInterval, r.flushPeriodically)
+	}
+
+	if conf.RollupWindow > 0 {
+		r.rollup = newRollupAggregator(clock)
+		r.rollupFlusher = newPeriodicFlusher()
+		go r.rollupFlusher.run(reportsCtx, conf.RollupWindow, r.flushRollups)
+	}
+
+	if r.spool != nil && r.enabled.Load() {
+		r.replaySpool()
+	}
+
+	if conf.StateDir != "" {
+		var err error
+		r.firstRun, err = markInstalled(clock, conf.StateDir)
+		if err != nil {
+			logger.Warn("Failed to check for first run", slog.Any("error", err))
+		}
+	}
+
+	if r.firstRun {
+		r.reportLifecycleEvent(installEventName)
+	}
+
+	if r.emitLifecycleEvents {
+		r.reportLifecycleEvent(startEventName)
+	}
+
+	context.AfterFunc(ctx, func() {
+		_ = r.Close()
+	})
+
+	return r
 }
 
-// Close aborts any ongoing telemetry reporting.
+// Close aborts any ongoing telemetry reporting. It's safe to call more than
+// once, subsequent calls return the result of the first.
 func (r *Reporter) Close() error {
-	r.reports.Go(func() error {
-		return context.Canceled
+	r.closeOnce.Do(func() {
+		// Stop accepting new reports.
+		r.shuttingDown.Store(true)
+
+		r.reports.Go(func() error {
+			return context.Canceled
+		})
+
+		// Any queued reports and unreported counts are discarded.
+		r.queue.close()
+		if r.streamingSink != nil {
+			r.streamingSink.abortStreams()
+		}
+		if r.retries != nil {
+			for _, report := range r.retries.close() {
+				r.spoolEvents(report.events)
+			}
+		}
+		if r.overflow != nil {
+			r.overflow.stop(false)
+		}
+		<-r.counters.done
+		if r.flusher != nil {
+			<-r.flusher.done
+		}
+		if r.rollupFlusher != nil {
+			<-r.rollupFlusher.done
+		}
+
+		if r.batcher != nil {
+			// Any buffered events are discarded.
+			<-r.batcher.done
+		}
+
+		if r.throttle != nil {
+			<-r.throttle.done
+		}
+
+		if err := r.reports.Wait(); err != nil && !errors.Is(err, context.Canceled) {
+			r.closeErr = err
+		}
 	})
 
-	if err := r.reports.Wait(); err != nil && !errors.Is(err, context.Canceled) {
-		return err
-	}
+	return r.closeErr
+}
 
-	return nil
+// CloseWithin waits up to d for any pending reports to complete, before
+// aborting the rest. It sits between Flush (wait for everything) and Close
+// (abort everything).
+func (r *Reporter) CloseWithin(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	// Anything still pending after the deadline is aborted by Close.
+	_ = r.Flush(ctx)
+
+	return r.Close()
 }
 
-// Shutdown gracefully shuts down the telemetry reporter.
+// Shutdown gracefully shuts down the telemetry reporter. It's safe to call
+// more than once (including concurrently), every call waits for the same
+// shutdown to complete.
 func (r *Reporter) Shutdown(ctx context.Context) error {
+	r.shutdownOnce.Do(r.startShutdown)
+
+	select {
+	case <-ctx.Done():
+		// Abort any ongoing reports.
+		return r.Close()
+	case <-r.shutdownDone:
+		if err := r.shutdownErr; err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+
+		return nil
+	}
+}
+
+// startShutdown stops accepting new reports, and starts waiting for the
+// pending reports to complete in the background.
+func (r *Reporter) startShutdown() {
+	if r.emitLifecycleEvents {
+		r.reportLifecycleEvent(shutdownEventName)
+	}
+
 	// Stop accepting new reports.
 	r.shuttingDown.Store(true)
 
-	reportsDone := make(chan error, 1)
+	// No point in holding back reports any longer.
+	if r.startupDelay != nil {
+		r.startupDelay.release()
+	}
+
 	go func() {
-		defer close(reportsDone)
+		defer close(r.shutdownDone)
+
+		// Everything is flushed below.
+		if r.flusher != nil {
+			r.flusher.stop()
+		}
+		if r.rollupFlusher != nil {
+			r.rollupFlusher.stop()
+		}
+
+		r.flushDuplicates()
+		r.flushRollups()
+
+		// Report the final counter values.
+		r.counters.stop()
+
+		// Flush any buffered events before waiting for the in-flight reports.
+		if r.batcher != nil {
+			r.batcher.stop()
+		}
+
+		if r.throttle != nil {
+			r.throttle.stop()
+		}
 
-		reportsDone <- r.reports.Wait()
+		// Report any events dropped up until now.
+		if r.overflow != nil {
+			r.overflow.stop(true)
+		}
+
+		// Give failed reports one last try.
+		if r.retries != nil {
+			r.retries.drain()
+		}
+
+		if r.spool != nil && r.drainSpool {
+			<-r.inFlight.wait()
+			r.drainSpooled()
+		}
+
+		// Confirm the events written to any streams.
+		if r.streamingSink != nil {
+			<-r.inFlight.wait()
+			if err := r.closeStreams(r.reportsCtx); err != nil {
+				r.logger.Debug("Failed to close event stream", slog.Any("error", err))
+			}
+		}
+
+		// The workers exit once the queue has been drained.
+		r.queue.close()
+
+		r.shutdownErr = r.reports.Wait()
 	}()
+}
 
-	select {
-	case <-ctx.Done():
-		// Abort any ongoing reports.
-		return r.Close()
-	case err := <-reportsDone:
-		if err != nil && !errors.Is(err, context.Canceled) {
+// Ping checks that the telemetry server is reachable and accepts our
+// credentials, by sending an empty batch of events. It works regardless of
+// whether reporting is enabled.
+func (r *Reporter) Ping(ctx context.Context) error {
+	errs := make([]error, len(r.sinks))
+	for i, sink := range r.sinks {
+		errs[i] = r.report(ctx, sink.Sink, nil)
+	}
+
+	return errors.Join(errs...)
+}
+
+// SessionID returns the current session id.
+func (r *Reporter) SessionID() string {
+	id, _ := r.session.current()
+	return id
+}
+
+// SetEnabled enables or disables telemetry reporting, eg. in response to the
+// user changing their consent. While disabled, reported events are dropped.
+func (r *Reporter) SetEnabled(enabled bool) {
+	// Takes precedence over the consent file and environment.
+	r.consentOverridden.Store(true)
+
+	if enabled {
+		r.authFailures.Store(0)
+		r.authDisabled.Store(false)
+	} else {
+		r.setDisabledReason("disabled by the application")
+	}
+
+	if r.enabled.Swap(enabled) != enabled {
+		if enabled {
+			r.logger.Info("Telemetry enabled")
+			r.reportDroppedWhileDisabled()
+		} else {
+			r.logger.Info("Telemetry disabled")
+			r.markDisabled()
+		}
+	}
+}
+
+// Enabled returns true if telemetry is currently being reported.
+func (r *Reporter) Enabled() bool {
+	return r.enabled.Load() && !r.authDisabled.Load()
+}
+
+// DisabledReason returns a short, human readable explanation of why telemetry
+// is disabled, eg. "NSH_NO_TELEMETRY set", or an empty string if it's enabled.
+// It's cheap enough to call frequently, eg. to display in a status line.
+func (r *Reporter) DisabledReason() string {
+	if !r.enabled.Load() {
+		if reason := r.disabledReason.Load(); reason != nil {
+			return *reason
+		}
+
+		return "disabled"
+	}
+
+	if r.authDisabled.Load() {
+		return "repeated authentication failures"
+	}
+
+	return ""
+}
+
+func (r *Reporter) setDisabledReason(reason string) {
+	r.disabledReason.Store(&reason)
+}
+
+// Flush blocks until all buffered and in-flight reports have completed, or
+// the context expires. Unlike Shutdown, the reporter continues to accept new
+// events after Flush returns. When streaming, the streams are closed, and an
+// error is returned if the server didn't confirm receipt of the events.
+func (r *Reporter) Flush(ctx context.Context) error {
+	r.flushDuplicates()
+	r.flushRollups()
+	r.flushCounters()
+
+	if r.batcher != nil {
+		if err := r.batcher.flushBuffered(ctx); err != nil {
 			return err
 		}
+	}
 
-		return nil
+	if r.throttle != nil {
+		if err := r.throttle.flushBuffered(ctx); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-r.inFlight.wait():
+	}
+
+	if err := r.closeStreams(ctx); err != nil {
+		return fmt.Errorf("failed to confirm streamed events: %w", err)
+	}
+
+	return nil
+}
+
+// flushDuplicates reports the number of suppressed duplicate events, unless
+// reporting has been disabled in the meantime.
+func (r *Reporter) flushDuplicates() {
+	if r.dedup == nil {
+		return
+	}
+
+	events := r.dedup.drain()
+	if !r.Enabled() {
+		return
+	}
+
+	// Like any other event, the summaries pass through the interceptors.
+	for _, event := range events {
+		_ = r.intercept(r.reportsCtx, event, func(ctx context.Context, event *v1alpha1.TelemetryEvent) Status {
+			return r.enqueue(ctx, event, false)
+		})
 	}
 }
 
-// ReportEvent reports a telemetry event.
+// ReportEvent reports a telemetry event. The event is timestamped with the
+// current time, unless it already has a timestamp (eg. when backfilling
+// historical events).
 func (r *Reporter) ReportEvent(event *v1alpha1.TelemetryEvent) {
-	event.Timestamp = timestamppb.Now()
+	r.ReportEventContext(context.Background(), event)
+}
 
-	if event.SessionId == "" {
-		event.SessionId = r.sessionID
+// ReportEventContext reports a telemetry event, using ctx as the parent
+// context for the report. The event is dropped if ctx is already done. A
+// deadline on ctx can shorten the report timeout, but never extend it (see
+// Configuration.DefaultReportTimeout). When batching is enabled, ctx only
+// bounds enqueuing the event.
+func (r *Reporter) ReportEventContext(ctx context.Context, event *v1alpha1.TelemetryEvent) {
+	_ = r.reportEventResult(ctx, event)
+}
+
+// ReportEventResult reports a telemetry event, returning whether the event was
+// accepted for reporting or the reason it was dropped.
+func (r *Reporter) ReportEventResult(event *v1alpha1.TelemetryEvent) Status {
+	return r.reportEventResult(context.Background(), event)
+}
+
+// ReportEventWithPriority reports a telemetry event with the given priority,
+// which determines which events are dropped first when there are too many
+// pending reports.
+func (r *Reporter) ReportEventWithPriority(event *v1alpha1.TelemetryEvent, priority v1alpha1.TelemetryEventPriority) Status {
+	if event != nil {
+		event.Priority = priority
 	}
+	return r.reportEventResult(context.Background(), event)
+}
 
-	event.Tags = append(event.Tags, r.tags...)
+// ReportEventWait reports a telemetry event, waiting for room in the send
+// queue until ctx is done, rather than dropping the event if there are too
+// many pending reports. It returns an error if the event wasn't accepted for
+// reporting, eg. if ctx expired first. When batching is enabled, the event is
+// buffered for batching as usual, without waiting.
+func (r *Reporter) ReportEventWait(ctx context.Context, event *v1alpha1.TelemetryEvent) error {
+	status := r.reportEventResult(context.WithValue(ctx, waitForRoomKey{}, true), event)
+	switch {
+	case status == StatusAccepted:
+		return nil
+	case (status == StatusDroppedOverflow || status == StatusDroppedCanceled) && ctx.Err() != nil:
+		return fmt.Errorf("timed out waiting for room in the send queue: %w", ctx.Err())
+	default:
+		return fmt.Errorf("event dropped: %s", status)
+	}
+}
+
+// ReportEventImportant reports a high-value telemetry event (eg. a crash),
+// bypassing sampling and rate limiting. The event is still subject to the
+// enabled flag, shutdown, deduplication, and the circuit breaker. When
+// batching is enabled, the event is sent immediately rather than waiting to
+// be batched. Unless otherwise set, the event is given high priority.
+func (r *Reporter) ReportEventImportant(event *v1alpha1.TelemetryEvent) Status {
+	if event != nil && event.Priority == v1alpha1.TelemetryEventPriority_NORMAL {
+		event.Priority = v1alpha1.TelemetryEventPriority_HIGH
+	}
+
+	status := r.reportEvent(context.Background(), event, true)
+	r.recordStatus(event, status)
+	return status
+}
+
+func (r *Reporter) reportEventResult(ctx context.Context, event *v1alpha1.TelemetryEvent) Status {
+	status := r.reportEvent(ctx, event, false)
+	r.recordStatus(event, status)
+	return status
+}
+
+func (r *Reporter) reportEvent(ctx context.Context, event *v1alpha1.TelemetryEvent, important bool) Status {
+	if ctx.Err() != nil {
+		return StatusDroppedCanceled
+	}
+
+	if !r.enabled.Load() || r.authDisabled.Load() {
+		r.disabledDrops.Add(1)
+		return StatusDroppedDisabled
+	}
+
+	// Before anything touches the event.
+	if event == nil {
+		r.rejectEvent(event, validateEvent(event, r.maxEventBytes, r.maxTags))
+		return StatusDroppedInvalid
+	}
+
+	if r.contextExtractor != nil {
+		event.Labels = mergeLabels(event.Labels, r.contextExtractor(ctx))
+	}
+
+	r.stamp(event)
 
 	if r.shuttingDown.Load() {
 		r.logger.Debug("Shutting down, dropping event")
+		return StatusDroppedShuttingDown
+	}
+
+	if !r.checkEvent(event) {
+		return StatusDroppedInvalid
+	}
+
+	if !important && !shouldSample(r.sampleRate, event) {
+		return StatusDroppedSampled
+	}
+
+	if r.dedup != nil && r.dedup.suppress(event) {
+		return StatusDroppedDuplicate
+	}
+
+	if !important && r.limiter != nil && !r.limiter.Allow(r.rateLimitKey(event)) {
+		r.logger.Debug("Rate limit exceeded, dropping event", slog.String("name", event.Name))
+		return StatusDroppedRateLimited
+	}
+
+	if r.breaker != nil && !r.breaker.allow() {
+		return StatusDroppedCircuitOpen
+	}
+
+	if len(r.interceptors) > 0 {
+		return r.intercept(ctx, event, func(ctx context.Context, event *v1alpha1.TelemetryEvent) Status {
+			return r.accept(ctx, event, important)
+		})
+	}
+
+	return r.accept(ctx, event, important)
+}
+
+// accept takes an event that has passed every filter (including the
+// interceptors), merging it into the current rollup window (if enabled and
+// not immediate), or otherwise enqueuing it.
+func (r *Reporter) accept(ctx context.Context, event *v1alpha1.TelemetryEvent, immediate bool) Status {
+	if ctx.Err() != nil {
+		return StatusDroppedCanceled
+	}
+
+	// Merged events are reported when the window closes.
+	if !immediate && r.rollup != nil && r.rollup.add(event) {
+		return StatusAccepted
+	}
+
+	return r.enqueue(ctx, event, immediate)
+}
+
+// checkEvent truncates an oversized event, and validates it. It returns false
+// if the event is invalid, and must be dropped.
+func (r *Reporter) checkEvent(event *v1alpha1.TelemetryEvent) bool {
+	if truncateEvent(event, r.maxEventBytes) {
+		r.logger.Debug("Truncated oversized event", slog.String("name", event.Name))
+	}
+
+	if err := validateEvent(event, r.maxEventBytes, r.maxTags); err != nil {
+		r.rejectEvent(event, err)
+		return false
+	}
+
+	return true
+}
+
+// rejectEvent logs and reports an invalid event.
+func (r *Reporter) rejectEvent(event *v1alpha1.TelemetryEvent, err error) {
+	r.logger.Debug("Dropping invalid event", slog.Any("error", err))
+
+	if r.onError != nil {
+		r.onError(event, err)
+	}
+}
+
+// stamp adds the timestamp (unless already set, eg. for historical events),
+// session id, and the reporter level tags and labels to an event.
+func (r *Reporter) stamp(event *v1alpha1.TelemetryEvent) {
+	if event.Timestamp == nil && !r.serverTimestamp {
+		event.Timestamp = timestamppb.New(r.clock.Now())
+	}
+
+	if event.SessionId == "" {
+		event.SessionId, event.PreviousSessionId = r.session.current()
+	}
+
+	if event.SchemaVersion == "" {
+		event.SchemaVersion = r.schemaVersion
+	}
+
+	attributes := r.attributes.Load()
+	event.Tags = append(event.Tags, attributes.tags...)
+	if r.tagFunc != nil {
+		event.Tags = append(event.Tags, r.tagFunc.tags()...)
+	}
+	event.Labels = mergeLabels(event.Labels, attributes.labels)
+
+	if r.redactor != nil {
+		event.Tags = redactTags(r.redactor, event.Tags)
+		event.Labels = redactLabels(r.redactor, event.Labels)
+	}
+
+	if r.cardinality != nil {
+		// The reporter's session, events can carry their own.
+		sessionID, _ := r.session.current()
+		r.cardinality.limit(sessionID, event.Labels)
+	}
+}
+
+// enqueue hands an event off for reporting, either by buffering it for
+// batching or by reporting it immediately.
+func (r *Reporter) enqueue(ctx context.Context, event *v1alpha1.TelemetryEvent, immediate bool) Status {
+	if ctx.Err() != nil {
+		// The caller gave up while the event was being prepared.
+		return StatusDroppedCanceled
+	}
+
+	// Numbered once accepted, so that any gaps are due to lost events.
+	if event.Sequence == 0 {
+		event.Sequence = r.session.nextSequence(event.SessionId)
+	}
+
+	if r.batcher != nil && !immediate {
+		if !r.batcher.add(event) {
+			r.logger.Warn("Too many buffered telemetry events, dropping event")
+			r.recordOverflow(1)
+			r.spoolEvents([]*v1alpha1.TelemetryEvent{event})
+			return StatusDroppedOverflow
+		}
+
+		return StatusAccepted
+	}
+
+	if !r.send(ctx, []*v1alpha1.TelemetryEvent{event}) {
+		return StatusDroppedOverflow
+	}
+
+	return StatusAccepted
+}
+
+// SampledOut returns the number of events that have been dropped by sampling.
+func (r *Reporter) SampledOut() uint64 {
+	return r.stats.droppedSampled.Load()
+}
+
+// Stats returns a snapshot of the reporter's event counters.
+func (r *Reporter) Stats() Stats {
+	stats := r.stats.snapshot()
+	stats.PausedUntil = r.pause.pausedUntil()
+	stats.InFlightBytes = uint64(r.queue.pendingBytes())
+	if elapsed := r.clock.Now().Sub(r.created); elapsed > 0 {
+		stats.ReportRate = float64(stats.Reports) / elapsed.Seconds()
+	}
+
+	return stats
+}
+
+// send enqueues the given events to be reported to the telemetry server,
+// using a single batched request if there is more than one event. The report
+// is canceled if either ctx or the reporter is done. It returns false if the
+// events were dropped because the send queue was full.
+//
+// When reports are throttled, the events are instead buffered until the next
+// report is allowed (and ctx is ignored).
+func (r *Reporter) send(ctx context.Context, events []*v1alpha1.TelemetryEvent) bool {
+	if r.throttle != nil {
+		if dropped := r.throttle.add(events); len(dropped) > 0 {
+			r.recordOverflowDrops(dropped)
+			r.logger.Warn("Too many throttled telemetry events, dropping oldest event")
+			r.recordOverflow(len(dropped))
+			r.spoolEvents(dropped)
+		}
+
+		return true
+	}
+
+	return r.push(ctx, events)
+}
+
+// waitForRoomKey marks a context as willing to wait for room in the send
+// queue, see ReportEventWait.
+type waitForRoomKey struct{}
+
+func waitsForRoom(ctx context.Context) bool {
+	wait, _ := ctx.Value(waitForRoomKey{}).(bool)
+	return wait
+}
+
+// push adds a report to the send queue.
+func (r *Reporter) push(ctx context.Context, events []*v1alpha1.TelemetryEvent) bool {
+	r.inFlight.add()
+	report := newPendingReport(ctx, events)
+	evicted, ok := r.queue.push(ctx, report, waitsForRoom(ctx))
+	if !ok {
+		r.inFlight.done()
+		r.logger.Warn("Too many pending telemetry reports, dropping event")
+		r.recordOverflow(len(events))
+		r.spoolEvents(events)
+		return false
+	}
+
+	for _, evicted := range evicted {
+		// The evicted events were already accepted.
+		r.inFlight.done()
+		r.recordOverflowDrops(evicted.events)
+		r.recordOverflow(len(evicted.events))
+		r.logger.Warn("Too many pending telemetry reports, dropping queued event")
+		r.spoolEvents(evicted.events)
+	}
+
+	return true
+}
+
+// sendWorker reports queued events until the queue is closed and drained.
+func (r *Reporter) sendWorker() error {
+	for {
+		report, ok := r.queue.pop()
+		if !ok {
+			return nil
+		}
+
+		// Hold off while the server has asked us to, reports queue up (up to
+		// the queue size) in the meantime.
+		_ = r.pause.wait(r.reportsCtx)
+
+		// Don't bother sending anything once the reporter has been closed,
+		// keep it for next time instead.
+		if r.reportsCtx.Err() == nil {
+			r.deliver(report)
+		} else {
+			r.spoolEvents(report.events)
+		}
+
+		r.queue.done(report)
+		r.inFlight.done()
+	}
+}
+
+// deliver reports the given events, retrying if necessary. Events that could
+// not be delivered are spooled (if enabled).
+func (r *Reporter) deliver(report *pendingReport) {
+	ctx, events := report.ctx, report.events
+
+	if r.startupDelay != nil {
+		if err := r.startupDelay.wait(ctx, r.reportsCtx); err != nil {
+			r.spoolEvents(events)
+			return
+		}
+	}
+
+	// The default is never longer than the absolute maximum limit, and a
+	// shorter caller deadline takes precedence.
+	ctx, cancel := context.WithTimeout(ctx, r.defaultTimeout)
+	defer cancel()
+
+	stop := context.AfterFunc(r.reportsCtx, cancel)
+	defer stop()
+
+	r.stats.reports.Add(1)
+
+	var err error
+	if len(r.sinks) == 1 {
+		err = r.deliverTo(ctx, r.sinks[0], events)
+	} else {
+		err = r.deliverToAll(ctx, events)
+	}
+
+	if r.breaker != nil {
+		// Only failures that suggest the server is down count.
+		if err != nil && isRetryable(err) {
+			r.breaker.recordFailure()
+		} else {
+			r.breaker.recordSuccess()
+		}
+	}
+
+	r.recordAuthResult(err)
+
+	if err != nil {
+		// Transient failures are retried later, the caller's context no
+		// longer applies.
+		if r.retries != nil && isRetryable(err) && r.reportsCtx.Err() == nil {
+			report.ctx = r.reportsCtx
+			if r.retries.add(report) {
+				return
+			}
+		}
+
+		r.stats.failedSend.Add(uint64(len(events)))
+
+		// No point in trying again later if the server rejected the events.
+		// Reports aborted by closing the reporter are kept for next time.
+		if isRetryable(err) || r.reportsCtx.Err() != nil {
+			r.spoolEvents(events)
+		}
+	} else if r.streamingSink == nil || r.dryRun {
+		// Streamed events are settled once their receipt is confirmed.
+		r.stats.deliveredOK.Add(uint64(len(events)))
+
+		if r.onSuccess != nil && !r.dryRun {
+			for _, event := range events {
+				r.onSuccess(event)
+			}
+		}
+	}
+}
+
+// sendThrottled reports the events coalesced by the throttler.
+func (r *Reporter) sendThrottled(events []*v1alpha1.TelemetryEvent) {
+	if !r.push(r.reportsCtx, events) {
+		r.recordOverflowDrops(events)
+	}
+}
+
+// resend adds a report from the retry queue back to the send queue.
+func (r *Reporter) resend(report *pendingReport) {
+	// It was already accepted, so it doesn't count against the queue size.
+	r.inFlight.add()
+	if !r.queue.pushReserved(report) {
+		r.inFlight.done()
+		r.stats.failedSend.Add(uint64(len(report.events)))
+		r.spoolEvents(report.events)
+	}
+}
+
+// deliverToAll delivers the events to every sink concurrently, so that a
+// failing sink doesn't hold up the others. It only returns an error if every
+// sink failed.
+func (r *Reporter) deliverToAll(ctx context.Context, events []*v1alpha1.TelemetryEvent) error {
+	errs := make([]error, len(r.sinks))
+
+	var wg sync.WaitGroup
+	for i, sink := range r.sinks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = r.deliverTo(ctx, sink, events)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// deliverTo delivers the events to a single sink, retrying if necessary.
+func (r *Reporter) deliverTo(ctx context.Context, sink namedSink, events []*v1alpha1.TelemetryEvent) error {
+	// Retries hold on to the worker, so they count against the maximum
+	// number of concurrent reports.
+	attempts, err := retry(ctx, r.clock, r.maxRetries, r.retryBackoff, func(ctx context.Context) error {
+		if err := r.pause.wait(ctx); err != nil {
+			return err
+		}
+
+		err := r.report(ctx, sink.Sink, events)
+		if d, ok := retryAfter(err, r.clock.Now()); ok {
+			r.logger.Debug("Telemetry server asked us to back off, pausing reports",
+				slog.Duration("retryAfter", d))
+			r.pause.pauseFor(d)
+		}
+
+		return err
+	})
+	// Streamed events are settled once their receipt is confirmed.
+	if r.audit != nil && !r.dryRun && (err != nil || r.streamingSink == nil) {
+		if auditErr := r.audit.record(sink.name, events, err); auditErr != nil {
+			r.logger.Warn("Failed to record audit log", slog.Any("error", auditErr))
+		}
+	}
+
+	if err == nil {
+		if attempts > 1 {
+			r.logger.Debug("Reported event after retrying", slog.Int("attempts", attempts))
+		}
+
+		return nil
+	}
+
+	if isAuthError(err) {
+		err = &AuthError{Err: err}
+	}
+
+	if sink.name != "" {
+		err = &SinkError{Sink: sink.name, Err: err}
+	}
+
+	// Don't spam the logs when the user is offline (unless asked to).
+	r.logger.Log(context.Background(), r.failureLogLevel.Level(), "Failed to report event",
+		slog.Int("attempts", attempts), slog.Any("error", err))
+
+	if r.onError != nil {
+		for _, event := range events {
+			r.onError(event, err)
+		}
+	}
+
+	return err
+}
+
+// sendBatch reports a batch of buffered events. As the events were already
+// accepted, any that can't be sent are counted as overflow drops.
+func (r *Reporter) sendBatch(events []*v1alpha1.TelemetryEvent) bool {
+	if !r.send(r.reportsCtx, events) {
+		r.recordOverflowDrops(events)
+		return false
+	}
+
+	return true
+}
+
+// spoolEvents persists the given events to the spool (if enabled), so that
+// they can be replayed later.
+func (r *Reporter) spoolEvents(events []*v1alpha1.TelemetryEvent) {
+	if r.spool == nil {
+		return
+	}
+
+	if err := r.spool.write(events); err != nil {
+		r.logger.Debug("Failed to spool events", slog.Any("error", err))
+	}
+}
+
+// replaySpool reports any events left over in the spool by a previous
+// reporter. Spooled events retain their original timestamps.
+func (r *Reporter) replaySpool() {
+	batches, err := r.spool.claim(r.concurrency)
+	if err != nil {
+		r.logger.Debug("Failed to replay spooled events", slog.Any("error", err))
+	}
+
+	for _, events := range batches {
+		_ = r.send(r.reportsCtx, events)
+	}
+}
+
+// drainSpooled replays all the events in the spool, waiting for them to be
+// reported. Events that fail to send again are left on the spool.
+func (r *Reporter) drainSpooled() {
+	files, err := r.spool.list(false)
+	if err != nil {
+		r.logger.Debug("Failed to drain spooled events", slog.Any("error", err))
 		return
 	}
 
-	started := r.reports.TryGo(func() error {
-		// Absolute maximum limit.
-		ctx, cancel := context.WithTimeout(r.reportsCtx, 30*time.Second)
-		defer cancel()
+	// Failed events are spooled again, so only replay the files that were
+	// there to begin with.
+	for remaining := len(files); remaining > 0; {
+		// Aborted by closing the reporter.
+		if r.reportsCtx.Err() != nil {
+			return
+		}
+
+		batches, err := r.spool.claim(min(remaining, r.concurrency))
+		if err != nil {
+			r.logger.Debug("Failed to drain spooled events", slog.Any("error", err))
+		}
 
-		req := &connect.Request[v1alpha1.TelemetryEvent]{Msg: event}
-		if r.authToken != "" {
-			req.Header().Set(
-				"Authorization",
-				"Bearer "+r.authToken,
-			)
+		if len(batches) == 0 {
+			return
 		}
+		remaining -= len(batches)
 
-		if _, err := r.client.Report(ctx, req); err != nil {
-			// Don't spam the logs when the user is offline.
-			fmt.Println("Failed to report event", err)
-			r.logger.Debug("Failed to report event", slog.Any("error", err))
+		for _, events := range batches {
+			_ = r.send(r.reportsCtx, events)
 		}
 
+		<-r.inFlight.wait()
+	}
+}
+
+// report makes a single attempt at reporting the given events to the sink.
+func (r *Reporter) report(ctx context.Context, sink Sink, events []*v1alpha1.TelemetryEvent) error {
+	if r.dryRun {
+		r.logDryRun(events)
 		return nil
-	})
-	if !started {
-		r.logger.Warn("Too many in-flight telemetry reports, dropping event")
 	}
+
+	return sendToSink(ctx, sink, events)
+}
+
+func (r *Reporter) setHeaders(ctx context.Context, header http.Header) error {
+	r.propagator.Inject(ctx, header)
+
+	for key, values := range r.headers {
+		header.Del(key)
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+
+	header.Set("User-Agent", r.userAgent)
+	header.Set(schemaVersionHeader, r.schemaVersion)
+
+	authToken := *r.authToken.Load()
+	if r.authTokens != nil {
+		var err error
+		authToken, err = r.authTokens.get(ctx)
+		if err != nil {
+			r.logger.Debug("Failed to obtain auth token", slog.Any("error", err))
+
+			if r.failOnAuthError {
+				return connect.NewError(connect.CodeUnauthenticated, err)
+			}
+		}
+	}
+
+	if authToken != "" {
+		header.Set(
+			"Authorization",
+			"Bearer "+authToken,
+		)
+	}
+
+	return nil
+}
+
+// inFlightReports tracks the number of in-flight reports. Unlike a
+// sync.WaitGroup it is safe to add reports while another goroutine is
+// waiting for them to complete.
+type inFlightReports struct {
+	mu      sync.Mutex
+	n       int
+	waiters []chan struct{}
+}
+
+func (f *inFlightReports) add() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.n++
+}
+
+func (f *inFlightReports) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.n--
+	if f.n == 0 {
+		for _, waiter := range f.waiters {
+			close(waiter)
+		}
+		f.waiters = nil
+	}
+}
+
+// wait returns a channel that is closed once there are no in-flight reports.
+func (f *inFlightReports) wait() <-chan struct{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	waiter := make(chan struct{})
+	if f.n == 0 {
+		close(waiter)
+	} else {
+		f.waiters = append(f.waiters, waiter)
+	}
+
+	return waiter
 }
@@ -10,12 +10,29 @@
 package telemetry_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"errors"
+	"io"
 	"log/slog"
+	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -24,31 +41,1511 @@ import (
 	"github.com/noisysockets/telemetry"
 	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
 	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1/v1alpha1connect"
+	"github.com/noisysockets/telemetry/internal/compress"
+	"github.com/noisysockets/telemetry/telemetrytest"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestTelemetryReporting(t *testing.T) {
 	ctx := context.Background()
 	logger := slogt.New(t)
 
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		Tags:    []string{"test"},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Shutdown(ctx))
+
+	ev := <-svc.receivedEvents
+	require.NotNil(t, ev)
+
+	require.Equal(t, []string{"test"}, ev.Tags)
+}
+
+func TestSessionRotation(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	clock := telemetrytest.NewClock(time.Now())
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:    baseURL,
+		SessionTTL: time.Hour,
+		Clock:      clock,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	first := <-svc.receivedEvents
+	second := <-svc.receivedEvents
+	require.Equal(t, first.SessionId, second.SessionId)
+	require.Empty(t, first.PreviousSessionId)
+
+	clock.Advance(time.Hour)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	third := <-svc.receivedEvents
+	require.NotEqual(t, first.SessionId, third.SessionId)
+	require.Equal(t, first.SessionId, third.PreviousSessionId)
+}
+
+func TestSequence(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	clock := telemetrytest.NewClock(time.Now())
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:    baseURL,
+		SessionTTL: time.Hour,
+		Clock:      clock,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for i := 0; i < 3; i++ {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+	}
+
+	for i := 1; i <= 3; i++ {
+		require.Equal(t, uint64(i), (<-svc.receivedEvents).Sequence)
+	}
+
+	// Dropped events don't consume a sequence number.
+	r.SetEnabled(false)
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	r.SetEnabled(true)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+	require.Equal(t, uint64(4), (<-svc.receivedEvents).Sequence)
+
+	// Rotating the session resets the sequence.
+	clock.Advance(time.Hour)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	ev := <-svc.receivedEvents
+	require.NotEmpty(t, ev.PreviousSessionId)
+	require.Equal(t, uint64(1), ev.Sequence)
+}
+
+func TestFallbackURLs(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:      "http://" + deadAddr(t),
+		FallbackURLs: []string{baseURL},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, svc.receivedEvents, 1)
+	require.Equal(t, uint64(1), r.Stats().DeliveredOK)
+}
+
+func TestClock(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := telemetrytest.NewClock(now)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		Clock:   clock,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+	require.Equal(t, now, (<-svc.receivedEvents).Timestamp.AsTime())
+
+	clock.Advance(time.Minute)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+	require.Equal(t, now.Add(time.Minute), (<-svc.receivedEvents).Timestamp.AsTime())
+
+	// Preset timestamps are kept, eg. for historical events.
+	r.ReportEvent(&v1alpha1.TelemetryEvent{
+		Name:      "test",
+		Timestamp: timestamppb.New(now.Add(-time.Hour)),
+	})
+	require.NoError(t, r.Flush(ctx))
+	require.Equal(t, now.Add(-time.Hour), (<-svc.receivedEvents).Timestamp.AsTime())
+}
+
+func TestSessionID(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for sessionID, valid := range map[string]bool{
+		"my-session":             true,
+		"":                       false,
+		"has whitespace":         false,
+		strings.Repeat("a", 129): false,
+	} {
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:   baseURL,
+			SessionID: sessionID,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		if valid {
+			require.Equal(t, sessionID, r.SessionID())
+		} else {
+			require.NotEqual(t, sessionID, r.SessionID())
+			require.NotEmpty(t, r.SessionID())
+		}
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+		require.Equal(t, r.SessionID(), (<-svc.receivedEvents).SessionId)
+	}
+}
+
+func TestStableIDSeed(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	clock := telemetrytest.NewClock(time.Now())
+
+	newReporter := func(seed string) *telemetry.Reporter {
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:      "http://" + deadAddr(t),
+			StableIDSeed: seed,
+			SessionTTL:   time.Hour,
+			Clock:        clock,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+		return r
+	}
+
+	r := newReporter("machine-1")
+	sessionID := r.SessionID()
+	require.Len(t, sessionID, 16)
+	require.NotContains(t, sessionID, "machine-1")
+
+	// Stable across runs, but not across machines.
+	require.Equal(t, sessionID, newReporter("machine-1").SessionID())
+	require.NotEqual(t, sessionID, newReporter("machine-2").SessionID())
+
+	// Never rotated.
+	clock.Advance(2 * time.Hour)
+	require.Equal(t, sessionID, r.SessionID())
+}
+
+func TestDynamicTags(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	var workspace atomic.Value
+	workspace.Store("workspace=a")
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		Tags:    []string{"static"},
+		TagFunc: func() []string {
+			return []string{workspace.Load().(string)}
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+	require.Equal(t, []string{"static", "workspace=a"}, (<-svc.receivedEvents).Tags)
+
+	workspace.Store("workspace=b")
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+	require.Equal(t, []string{"static", "workspace=b"}, (<-svc.receivedEvents).Tags)
+}
+
+func TestSlowDynamicTags(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		TagFunc: func() []string {
+			if calls.Add(1) == 1 {
+				return []string{"workspace=a"}
+			}
+
+			<-release
+			return []string{"workspace=b"}
+		},
+		TagFuncTimeout: 10 * time.Millisecond,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+	require.Equal(t, []string{"workspace=a"}, (<-svc.receivedEvents).Tags)
+
+	// While the tag function is stuck, the last known tags are used, and it
+	// isn't called again.
+	for i := 0; i < 3; i++ {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+		require.Equal(t, []string{"workspace=a"}, (<-svc.receivedEvents).Tags)
+	}
+	require.Equal(t, int32(2), calls.Load())
+
+	close(release)
+
+	require.Eventually(t, func() bool {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		if err := r.Flush(ctx); err != nil {
+			return false
+		}
+
+		return slices.Equal([]string{"workspace=b"}, (<-svc.receivedEvents).Tags)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestFlush(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for i := 0; i < 2; i++ {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+		require.NoError(t, r.Flush(ctx))
+
+		// The event must have been delivered by the time Flush returns.
+		select {
+		case ev := <-svc.receivedEvents:
+			require.NotNil(t, ev)
+		default:
+			t.Fatal("event not delivered")
+		}
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		RateLimits: map[string]telemetry.RateLimit{
+			"noisy": {Rate: 0.001, Burst: 2},
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for i := 0; i < 5; i++ {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "noisy"})
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "quiet"})
+		require.NoError(t, r.Flush(ctx))
+	}
+
+	counts := map[string]int{}
+	for len(svc.receivedEvents) > 0 {
+		counts[(<-svc.receivedEvents).Name]++
+	}
+
+	require.Equal(t, map[string]int{"noisy": 2, "quiet": 5}, counts)
+}
+
+func TestRootCAs(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(svc))
+
+	srv := httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: srv.URL,
+		RootCAs: roots,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, svc.receivedEvents, 1)
+}
+
+func TestDefaultRootCAs(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(svc))
+
+	srv := httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+
+	defaultRootCAs := telemetry.DefaultRootCAs
+	t.Cleanup(func() {
+		telemetry.DefaultRootCAs = defaultRootCAs
+	})
+
+	telemetry.DefaultRootCAs = x509.NewCertPool()
+	telemetry.DefaultRootCAs.AddCert(srv.Certificate())
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: srv.URL,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, svc.receivedEvents, 1)
+}
+
+func TestHTTP2Keepalive(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(svc))
+
+	protoMajor := make(chan int, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		protoMajor <- req.ProtoMajor
+		mux.ServeHTTP(w, req)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:              srv.URL,
+		RootCAs:              roots,
+		HTTP2ReadIdleTimeout: 10 * time.Second,
+		HTTP2PingTimeout:     5 * time.Second,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, svc.receivedEvents, 1)
+	require.Equal(t, 2, <-protoMajor)
+}
+
+func TestConnMaxLifetime(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for connMaxLifetime, wantConns := range map[time.Duration]int64{
+		0:                     1,
+		50 * time.Millisecond: 2,
+	} {
+		svc := newMockSvc()
+
+		mux := http.NewServeMux()
+		mux.Handle(v1alpha1connect.NewTelemetryHandler(svc))
+
+		var conns atomic.Int64
+		srv := httptest.NewUnstartedServer(mux)
+		srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				conns.Add(1)
+			}
+		}
+		srv.EnableHTTP2 = true
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+
+		roots := x509.NewCertPool()
+		roots.AddCert(srv.Certificate())
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:         srv.URL,
+			RootCAs:         roots,
+			ConnMaxLifetime: connMaxLifetime,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+
+		time.Sleep(100 * time.Millisecond)
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+
+		require.Len(t, svc.receivedEvents, 2)
+		require.Equal(t, wantConns, conns.Load())
+	}
+}
+
+func TestClientCertificate(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(svc))
+
+	authorization := make(chan string, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		authorization <- req.Header.Get("Authorization")
+		mux.ServeHTTP(w, req)
+	}))
+	t.Cleanup(srv.Close)
+
+	// A self-signed CA that issues the client certificate.
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	clientDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, &clientKey.PublicKey, caKey)
+	require.NoError(t, err)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	srv.StartTLS()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:   srv.URL,
+		AuthToken: "secret",
+		RootCAs:   roots,
+		ClientCertificate: &tls.Certificate{
+			Certificate: [][]byte{clientDER},
+			PrivateKey:  clientKey,
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, svc.receivedEvents, 1)
+	require.Equal(t, "Bearer secret", <-authorization)
+}
+
+func TestCompression(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(svc,
+		connect.WithCompression(compress.Zstd, compress.NewZstdDecompressor, compress.NewZstdCompressor)))
+
+	contentEncodings := make(chan string, 10)
+	baseURL := startHTTPServer(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		contentEncodings <- req.Header.Get("Content-Encoding")
+		mux.ServeHTTP(w, req)
+	}))
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for compression, expected := range map[string]string{
+		"":                        "gzip",
+		telemetry.CompressionGzip: "gzip",
+		telemetry.CompressionZstd: "zstd",
+		telemetry.CompressionNone: "",
+	} {
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:     baseURL,
+			Compression: compression,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test", Message: "hello"})
+		require.NoError(t, r.Flush(ctx))
+
+		require.Equal(t, expected, <-contentEncodings)
+		require.Equal(t, "hello", (<-svc.receivedEvents).Message)
+	}
+}
+
+func TestProxy(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	var proxied atomic.Int32
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			proxied.Add(1)
+			// Connect directly.
+			return nil, nil
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, svc.receivedEvents, 1)
+	require.NotZero(t, proxied.Load())
+}
+
+func TestDialContext(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	u, err := url.Parse(baseURL)
+	require.NoError(t, err)
+
+	dialed := make(chan string, 10)
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed <- addr
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, svc.receivedEvents, 1)
+	require.Equal(t, u.Host, <-dialed)
+}
+
+func TestUnixSocket(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	// Keep the path short, as Unix socket paths are limited in length.
+	dir, err := os.MkdirTemp("", "telemetry")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, os.RemoveAll(dir))
+	})
+
+	socketPath := filepath.Join(dir, "agent.sock")
+
+	lis, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+
+	svc := newMockSvc()
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(svc))
+
+	type request struct {
+		protoMajor    int
+		host          string
+		authorization string
+	}
+
+	requests := make(chan request, 10)
+	srv := &http.Server{
+		Handler: h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests <- request{
+				protoMajor:    req.ProtoMajor,
+				host:          req.Host,
+				authorization: req.Header.Get("Authorization"),
+			}
+			mux.ServeHTTP(w, req)
+		}), &http2.Server{}),
+	}
+	t.Cleanup(func() {
+		require.NoError(t, srv.Close())
+	})
+
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+
+	tests := []struct {
+		name string
+		conf telemetry.Configuration
+		host string
+	}{
+		{
+			name: "Unix URL",
+			conf: telemetry.Configuration{
+				BaseURL: "unix://" + socketPath,
+			},
+			host: "localhost",
+		},
+		{
+			name: "Unix socket",
+			conf: telemetry.Configuration{
+				BaseURL:    "https://telemetry.example.com",
+				UnixSocket: socketPath,
+			},
+			host: "telemetry.example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			conf.AuthToken = "secret"
+
+			r := telemetry.NewReporter(ctx, logger, conf)
+			t.Cleanup(func() {
+				require.NoError(t, r.Close())
+			})
+
+			r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			t.Cleanup(cancel)
+
+			require.NoError(t, r.Flush(ctx))
+
+			require.Equal(t, "test", (<-svc.receivedEvents).Name)
+
+			req := <-requests
+			require.Equal(t, 2, req.protoMajor)
+			require.Equal(t, tt.host, req.host)
+			require.Equal(t, "Bearer secret", req.authorization)
+		})
+	}
+}
+
+func TestReportTimeout(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+	t.Cleanup(func() {
+		close(svc.release)
+	})
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:       baseURL,
+		ReportTimeout: 100 * time.Millisecond,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	t.Cleanup(cancel)
+
+	// The stalled report should have been abandoned well before the deadline.
+	require.NoError(t, r.Flush(ctx))
+	require.Empty(t, svc.receivedEvents)
+}
+
+func TestDefaultReportTimeout(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+	t.Cleanup(func() {
+		close(svc.release)
+	})
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:              baseURL,
+		DefaultReportTimeout: 100 * time.Millisecond,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	// A longer caller deadline can't extend the default.
+	reportCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	t.Cleanup(cancel)
+
+	start := time.Now()
+	r.ReportEventContext(reportCtx, &v1alpha1.TelemetryEvent{Name: "test"})
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+	ctx, cancel = context.WithTimeout(ctx, time.Second)
+	t.Cleanup(cancel)
+
+	// The stalled reports should have been abandoned well before the deadline.
+	require.NoError(t, r.Flush(ctx))
+	require.Less(t, time.Since(start), time.Second)
+	require.Empty(t, svc.receivedEvents)
+	require.Equal(t, uint64(2), r.Stats().FailedSend)
+}
+
+func TestReportEventContext(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+	t.Cleanup(func() {
+		close(svc.release)
+	})
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	r.ReportEventContext(canceledCtx, &v1alpha1.TelemetryEvent{Name: "test"})
+	require.Equal(t, uint64(1), r.Stats().DroppedCanceled)
+
+	// The caller's deadline should bound the stalled report.
+	reportCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	t.Cleanup(cancel)
+
+	r.ReportEventContext(reportCtx, &v1alpha1.TelemetryEvent{Name: "test"})
+
+	ctx, cancel = context.WithTimeout(ctx, time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Flush(ctx))
+	require.Empty(t, svc.receivedEvents)
+	require.Equal(t, uint64(1), r.Stats().FailedSend)
+}
+
+func TestCodec(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(svc))
+
+	type request struct {
+		contentType string
+		body        []byte
+	}
+	requests := make(chan request, 10)
+	baseURL := startHTTPServer(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		requests <- request{contentType: req.Header.Get("Content-Type"), body: body}
+
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		mux.ServeHTTP(w, req)
+	}))
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:     baseURL,
+		Codec:       telemetry.CodecJSON,
+		Compression: telemetry.CompressionNone,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	event := &v1alpha1.TelemetryEvent{
+		Kind:    v1alpha1.TelemetryEventKind_ERROR,
+		Name:    "test",
+		Message: "something went wrong",
+		Values:  map[string]string{"foo": "bar"},
+		StackTrace: []*v1alpha1.StackFrame{
+			{Function: "main.main", File: "main.go", Line: 42},
+		},
+		Tags: []string{"linux"},
+	}
+	r.ReportEvent(event)
+	require.NoError(t, r.Flush(ctx))
+
+	req := <-requests
+	require.Equal(t, "application/json", req.contentType)
+	require.True(t, json.Valid(req.body))
+
+	// All fields (including the timestamp) should survive the round trip.
+	require.True(t, proto.Equal(event, <-svc.receivedEvents))
+}
+
+func TestProtocol(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(svc))
+
+	contentTypes := make(chan string, 10)
+	baseURL := startHTTPServer(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		contentTypes <- req.Header.Get("Content-Type")
+		mux.ServeHTTP(w, req)
+	}))
+
+	// Plaintext HTTP/2 (h2c), as required by gRPC.
+	httpClient := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for protocol, contentType := range map[string]string{
+		"":                        "application/proto",
+		telemetry.ProtocolConnect: "application/proto",
+		telemetry.ProtocolGRPC:    "application/grpc",
+		telemetry.ProtocolGRPCWeb: "application/grpc-web+proto",
+	} {
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:    baseURL,
+			HTTPClient: httpClient,
+			Protocol:   protocol,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+
+		require.Equal(t, contentType, <-contentTypes)
+		require.Len(t, svc.receivedEvents, 1)
+		<-svc.receivedEvents
+	}
+}
+
+func TestConnectOptions(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	var calls atomic.Int32
+	interceptor := connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+			calls.Add(1)
+			return next(ctx, req)
+		}
+	})
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:        baseURL,
+		ConnectOptions: []connect.ClientOption{connect.WithInterceptors(interceptor)},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, svc.receivedEvents, 1)
+	require.Equal(t, int32(1), calls.Load())
+}
+
+func TestOnError(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &failingSvc{mockSvc: newMockSvc(), code: connect.CodeUnauthenticated}
+	svc.failures.Store(1)
+	baseURL := startServer(t, svc)
+
+	type failure struct {
+		event *v1alpha1.TelemetryEvent
+		err   error
+	}
+	failures := make(chan failure, 10)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		OnError: func(event *v1alpha1.TelemetryEvent, err error) {
+			failures <- failure{event: event, err: err}
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "first"})
+	require.NoError(t, r.Flush(ctx))
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "second"})
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, failures, 1)
+	f := <-failures
+	require.Equal(t, "first", f.event.Name)
+	require.Equal(t, connect.CodeUnauthenticated, connect.CodeOf(f.err))
+}
+
+func TestOnSuccess(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &failingSvc{mockSvc: newMockSvc(), code: connect.CodeInvalidArgument}
+	svc.failures.Store(1)
+	baseURL := startServer(t, svc)
+
+	delivered := make(chan string, 10)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		OnSuccess: func(event *v1alpha1.TelemetryEvent) {
+			delivered <- event.Name
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "rejected"})
+	require.NoError(t, r.Flush(ctx))
+
+	for _, name := range []string{"first", "second", "third"} {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: name})
+	}
+	require.NoError(t, r.Flush(ctx))
+
+	var names []string
+	for len(delivered) > 0 {
+		names = append(names, <-delivered)
+	}
+	require.ElementsMatch(t, []string{"first", "second", "third"}, names)
+}
+
+func TestFailureLogLevel(t *testing.T) {
+	ctx := context.Background()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for _, level := range []slog.Leveler{nil, slog.LevelWarn} {
+		svc := &failingSvc{mockSvc: newMockSvc(), code: connect.CodeUnauthenticated}
+		svc.failures.Store(1)
+		baseURL := startServer(t, svc)
+
+		var logs lockedBuffer
+		logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:         baseURL,
+			FailureLogLevel: level,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+
+		// Failures are logged at debug level by default.
+		require.Equal(t, level != nil, strings.Contains(logs.String(), "Failed to report event"))
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(svc))
+
+	headers := make(chan http.Header, 10)
+	baseURL := startHTTPServer(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		headers <- req.Header.Clone()
+		mux.ServeHTTP(w, req)
+	}))
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:   baseURL,
+		AuthToken: "secret",
+		Headers: http.Header{
+			"X-Api-Key":     []string{"key"},
+			"X-Tenant-Id":   []string{"tenant"},
+			"Authorization": []string{"Basic ignored"},
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Flush(ctx))
+
+	header := <-headers
+	require.Equal(t, "key", header.Get("X-Api-Key"))
+	require.Equal(t, "tenant", header.Get("X-Tenant-Id"))
+	require.Equal(t, "Bearer secret", header.Get("Authorization"))
+}
+
+func TestPing(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	r.SetEnabled(false)
+
+	require.NoError(t, r.Ping(ctx))
+	require.Empty(t, (<-svc.receivedBatches).Events)
+
+	r = telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: "http://" + deadAddr(t),
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.Equal(t, connect.CodeUnavailable, connect.CodeOf(r.Ping(ctx)))
+}
+
+func TestVerifyOnStart(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r, err := telemetry.NewReporterWithVerify(ctx, logger, telemetry.Configuration{
+		BaseURL:       baseURL,
+		VerifyOnStart: true,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.Empty(t, (<-svc.receivedBatches).Events)
+
+	_, err = telemetry.NewReporterWithVerify(ctx, logger, telemetry.Configuration{
+		BaseURL:       "http://" + deadAddr(t),
+		VerifyOnStart: true,
+		VerifyTimeout: time.Second,
+	})
+	require.Error(t, err)
+
+	// Not verified unless requested.
+	r, err = telemetry.NewReporterWithVerify(ctx, logger, telemetry.Configuration{
+		BaseURL: "http://" + deadAddr(t),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	var logs lockedBuffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		Tags:    []string{"dev"},
+		DryRun:  true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "connected"})
+
+	// Disabled reporting still applies.
+	r.SetEnabled(false)
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "disconnected"})
+
+	require.NoError(t, r.Flush(ctx))
+
+	require.Empty(t, svc.receivedEvents)
+	require.Equal(t, uint64(1), r.Stats().DeliveredOK)
+
+	output := logs.String()
+	require.Contains(t, output, "Dry run, not reporting event")
+	require.Contains(t, output, "connected")
+	require.Contains(t, output, "dev")
+	require.Contains(t, output, r.SessionID())
+	require.NotContains(t, output, "disconnected")
+}
+
+func TestUserAgent(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(svc))
+
+	userAgents := make(chan string, 10)
+	baseURL := startHTTPServer(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		userAgents <- req.Header.Get("User-Agent")
+		mux.ServeHTTP(w, req)
+	}))
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for _, conf := range []telemetry.Configuration{
+		{BaseURL: baseURL, UserAgent: "mytool/1.0"},
+		{BaseURL: baseURL, UserAgent: "mytool/1.0", AuthToken: "secret"},
+		{BaseURL: baseURL},
+	} {
+		r := telemetry.NewReporter(ctx, logger, conf)
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+
+		userAgent := <-userAgents
+		if conf.UserAgent != "" {
+			require.Equal(t, conf.UserAgent, userAgent)
+		} else {
+			require.True(t, strings.HasPrefix(userAgent, "noisysockets-telemetry/"))
+		}
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(svc))
+
+	schemaVersions := make(chan string, 10)
+	baseURL := startHTTPServer(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		schemaVersions <- req.Header.Get("X-Telemetry-Schema-Version")
+		mux.ServeHTTP(w, req)
+	}))
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for _, conf := range []telemetry.Configuration{
+		{BaseURL: baseURL, SchemaVersion: "2024-06"},
+		{BaseURL: baseURL},
+	} {
+		r := telemetry.NewReporter(ctx, logger, conf)
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+
+		want := conf.SchemaVersion
+		if want == "" {
+			want = telemetry.DefaultSchemaVersion
+		}
+
+		require.Equal(t, want, <-schemaVersions)
+		require.Equal(t, want, (<-svc.receivedEvents).SchemaVersion)
+	}
+}
+
+func TestServerTimestamp(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:         baseURL,
+		ServerTimestamp: true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "unstamped"})
+	require.NoError(t, r.Flush(ctx))
+
+	require.Nil(t, (<-svc.receivedEvents).Timestamp)
+
+	// Explicit timestamps are kept.
+	preset := timestamppb.New(time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC))
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "preset", Timestamp: preset})
+	require.NoError(t, r.Flush(ctx))
+
+	require.True(t, proto.Equal(preset, (<-svc.receivedEvents).Timestamp))
+}
+
+// startServer starts a telemetry server backed by the given service and
+// returns its base URL.
+func startServer(t *testing.T, svc v1alpha1connect.TelemetryHandler) string {
 	mux := http.NewServeMux()
 
-	receivedEvents := make(chan *v1alpha1.TelemetryEvent, 1)
-	path, handler := v1alpha1connect.NewTelemetryHandler(&mockSvc{receivedEvents: receivedEvents})
+	path, handler := v1alpha1connect.NewTelemetryHandler(svc)
 	mux.Handle(path, handler)
 
+	return startHTTPServer(t, mux)
+}
+
+// startHTTPServer starts a HTTP server with the given handler and returns its
+// base URL.
+func startHTTPServer(t *testing.T, handler http.Handler) string {
+	logger := slogt.New(t)
+
 	lis, err := net.Listen("tcp", "localhost:0")
 	require.NoError(t, err)
 
 	srv := &http.Server{
 		// Use h2c to support HTTP/2 over cleartext.
-		Handler: h2c.NewHandler(mux, &http2.Server{}),
+		Handler: h2c.NewHandler(handler, &http2.Server{}),
 	}
 	t.Cleanup(func() {
-		require.NoError(t, srv.Shutdown(ctx))
+		require.NoError(t, srv.Close())
 	})
 
 	go func() {
@@ -61,33 +1558,58 @@ func TestTelemetryReporting(t *testing.T) {
 	// Wait for the server to start.
 	time.Sleep(100 * time.Millisecond)
 
-	baseURL := "http://" + lis.Addr().String()
-	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
-		BaseURL: baseURL,
-		Tags:    []string{"test"},
-	})
-	t.Cleanup(func() {
-		require.NoError(t, r.Close())
-	})
+	return "http://" + lis.Addr().String()
+}
 
-	r.ReportEvent(&v1alpha1.TelemetryEvent{})
+type mockSvc struct {
+	receivedEvents  chan *v1alpha1.TelemetryEvent
+	receivedBatches chan *v1alpha1.TelemetryEventBatch
+}
 
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	t.Cleanup(cancel)
+func newMockSvc() *mockSvc {
+	return &mockSvc{
+		receivedEvents:  make(chan *v1alpha1.TelemetryEvent, 100),
+		receivedBatches: make(chan *v1alpha1.TelemetryEventBatch, 100),
+	}
+}
 
-	require.NoError(t, r.Shutdown(ctx))
+func (s *mockSvc) Report(ctx context.Context, req *connect.Request[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error) {
+	s.receivedEvents <- req.Msg
+	return &connect.Response[emptypb.Empty]{}, nil
+}
 
-	ev := <-receivedEvents
-	require.NotNil(t, ev)
+func (s *mockSvc) BatchReport(ctx context.Context, req *connect.Request[v1alpha1.TelemetryEventBatch]) (*connect.Response[emptypb.Empty], error) {
+	s.receivedBatches <- req.Msg
+	return &connect.Response[emptypb.Empty]{}, nil
+}
 
-	require.Equal(t, []string{"test"}, ev.Tags)
+func (s *mockSvc) StreamReport(ctx context.Context, stream *connect.ClientStream[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error) {
+	for stream.Receive() {
+		s.receivedEvents <- stream.Msg()
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+
+	return &connect.Response[emptypb.Empty]{}, nil
 }
 
-type mockSvc struct {
-	receivedEvents chan *v1alpha1.TelemetryEvent
+// lockedBuffer is a bytes.Buffer that is safe for concurrent use.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
 }
 
-func (s *mockSvc) Report(ctx context.Context, req *connect.Request[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error) {
-	s.receivedEvents <- req.Msg
-	return &connect.Response[emptypb.Empty]{}, nil
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
 }
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"connectrpc.com/connect"
+)
+
+// The default base backoff duration between retries.
+const defaultRetryBackoff = 500 * time.Millisecond
+
+// retry calls fn until it succeeds, it returns a permanent error, the maximum
+// number of retries is reached, or the context expires. The delay between
+// attempts grows exponentially from the base backoff, with jitter. It returns
+// the number of attempts made and the last error.
+func retry(ctx context.Context, clock Clock, maxRetries int, backoff time.Duration, fn func(ctx context.Context) error) (int, error) {
+	var attempts int
+	for {
+		err := fn(ctx)
+		attempts++
+		if err == nil || attempts > maxRetries || !isRetryable(err) {
+			return attempts, err
+		}
+
+		// Exponential backoff, with jitter in the range [delay/2, delay).
+		delay := backoff << (attempts - 1)
+		delay = delay/2 + rand.N(delay/2+1)
+
+		if sleep(ctx, clock, delay) != nil {
+			return attempts, err
+		}
+	}
+}
+
+// isRetryable returns true if the error is likely to be transient.
+func isRetryable(err error) bool {
+	switch connect.CodeOf(err) {
+	case connect.CodeUnavailable,
+		connect.CodeResourceExhausted,
+		connect.CodeAborted,
+		connect.CodeDeadlineExceeded,
+		connect.CodeInternal,
+		connect.CodeUnknown:
+		return true
+	default:
+		// Permanent errors, eg. bad requests or authentication failures.
+		return false
+	}
+}
@@ -0,0 +1,285 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/telemetrytest"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	t.Run("Transient Error", func(t *testing.T) {
+		svc := &failingSvc{mockSvc: newMockSvc(), code: connect.CodeUnavailable}
+		svc.failures.Store(2)
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:      baseURL,
+			MaxRetries:   3,
+			RetryBackoff: 10 * time.Millisecond,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		t.Cleanup(cancel)
+
+		require.NoError(t, r.Flush(ctx))
+
+		require.Equal(t, int32(3), svc.attempts.Load())
+		require.Len(t, svc.receivedEvents, 1)
+	})
+
+	t.Run("Permanent Error", func(t *testing.T) {
+		svc := &failingSvc{mockSvc: newMockSvc(), code: connect.CodeUnauthenticated}
+		svc.failures.Store(2)
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:      baseURL,
+			MaxRetries:   3,
+			RetryBackoff: 10 * time.Millisecond,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		t.Cleanup(cancel)
+
+		require.NoError(t, r.Flush(ctx))
+
+		require.Equal(t, int32(1), svc.attempts.Load())
+		require.Len(t, svc.receivedEvents, 0)
+	})
+}
+
+// failingSvc fails the first n reports with the given error code.
+type failingSvc struct {
+	*mockSvc
+	code     connect.Code
+	failures atomic.Int32
+	attempts atomic.Int32
+}
+
+func (s *failingSvc) Report(ctx context.Context, req *connect.Request[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error) {
+	s.attempts.Add(1)
+	if s.failures.Add(-1) >= 0 {
+		return nil, connect.NewError(s.code, errors.New("injected failure"))
+	}
+
+	return s.mockSvc.Report(ctx, req)
+}
+
+func TestRetryQueue(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	t.Run("Flaky", func(t *testing.T) {
+		svc := &failingSvc{mockSvc: newMockSvc(), code: connect.CodeUnavailable}
+		svc.failures.Store(2)
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:        baseURL,
+			RetryQueueSize: 10,
+			RetryBackoff:   10 * time.Millisecond,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "flaky"})
+
+		select {
+		case ev := <-svc.receivedEvents:
+			require.Equal(t, "flaky", ev.Name)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for retried event")
+		}
+
+		require.Equal(t, int32(3), svc.attempts.Load())
+
+		require.Eventually(t, func() bool {
+			return r.Stats().DeliveredOK == 1
+		}, 5*time.Second, 10*time.Millisecond)
+		require.Zero(t, r.Stats().FailedSend)
+	})
+
+	t.Run("Drained On Shutdown", func(t *testing.T) {
+		svc := &failingSvc{mockSvc: newMockSvc(), code: connect.CodeUnavailable}
+		svc.failures.Store(1)
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:        baseURL,
+			RetryQueueSize: 10,
+			RetryBackoff:   time.Hour,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "pending"})
+		require.NoError(t, r.Flush(ctx))
+		require.Empty(t, svc.receivedEvents)
+
+		require.NoError(t, r.Shutdown(ctx))
+		require.Len(t, svc.receivedEvents, 1)
+	})
+
+	t.Run("Clock", func(t *testing.T) {
+		svc := &failingSvc{mockSvc: newMockSvc(), code: connect.CodeUnavailable}
+		svc.failures.Store(1)
+		baseURL := startServer(t, svc)
+
+		clock := telemetrytest.NewClock(time.Now())
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:        baseURL,
+			RetryQueueSize: 10,
+			RetryBackoff:   time.Hour,
+			Clock:          clock,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+
+		// The retry is scheduled on the clock, so it waits for the clock to
+		// move.
+		require.Equal(t, 1, clock.Timers())
+		require.Empty(t, svc.receivedEvents)
+
+		clock.Advance(time.Hour)
+
+		select {
+		case ev := <-svc.receivedEvents:
+			require.Equal(t, "test", ev.Name)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for retried event")
+		}
+	})
+
+	t.Run("Exhausted", func(t *testing.T) {
+		svc := &failingSvc{mockSvc: newMockSvc(), code: connect.CodeUnavailable}
+		svc.failures.Store(100)
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:        baseURL,
+			RetryQueueSize: 10,
+			RetryBackoff:   time.Millisecond,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+		require.Eventually(t, func() bool {
+			return r.Stats().FailedSend == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		// The initial attempt, and 5 more from the retry queue.
+		require.Equal(t, int32(6), svc.attempts.Load())
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &rateLimitedSvc{mockSvc: newMockSvc(), requestTimes: make(chan time.Time, 10)}
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:      baseURL,
+		MaxRetries:   1,
+		RetryBackoff: time.Millisecond,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "first"})
+
+	rateLimited := <-svc.requestTimes
+
+	require.Eventually(t, func() bool {
+		return !r.Stats().PausedUntil.IsZero()
+	}, time.Second, 10*time.Millisecond)
+
+	// Queued while paused.
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "second"})
+
+	require.NoError(t, r.Flush(ctx))
+
+	// Sending resumed once the server allowed it.
+	for i := 0; i < 2; i++ {
+		require.GreaterOrEqual(t, (<-svc.requestTimes).Sub(rateLimited), 900*time.Millisecond)
+	}
+
+	var names []string
+	for len(svc.receivedEvents) > 0 {
+		names = append(names, (<-svc.receivedEvents).Name)
+	}
+	require.ElementsMatch(t, []string{"first", "second"}, names)
+
+	require.Zero(t, r.Stats().PausedUntil)
+	require.Zero(t, r.Stats().FailedSend)
+}
+
+// rateLimitedSvc rate limits the first report, asking the client to retry
+// after a second.
+type rateLimitedSvc struct {
+	*mockSvc
+	requests     atomic.Int32
+	requestTimes chan time.Time
+}
+
+func (s *rateLimitedSvc) Report(ctx context.Context, req *connect.Request[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error) {
+	s.requestTimes <- time.Now()
+
+	if s.requests.Add(1) == 1 {
+		err := connect.NewError(connect.CodeResourceExhausted, errors.New("too many requests"))
+		err.Meta().Set("Retry-After", "1")
+		return nil, err
+	}
+
+	return s.mockSvc.Report(ctx, req)
+}
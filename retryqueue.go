@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+const (
+	// The maximum number of times a failed report is retried from the retry
+	// queue.
+	maxRequeues = 5
+	// The maximum delay before a failed report is retried from the retry
+	// queue.
+	maxRequeueBackoff = 5 * time.Minute
+)
+
+// retryQueue holds failed reports in memory, and resends them after a backoff.
+// Unlike the spool, reports in the retry queue don't survive a restart.
+type retryQueue struct {
+	clock   Clock
+	size    int
+	backoff time.Duration
+	resend  func(report *pendingReport)
+	mu      sync.Mutex
+	pending map[*pendingReport]Timer
+	closed  bool
+}
+
+func newRetryQueue(clock Clock, size int, backoff time.Duration, resend func(report *pendingReport)) *retryQueue {
+	return &retryQueue{
+		clock:   clock,
+		size:    size,
+		backoff: backoff,
+		resend:  resend,
+		pending: make(map[*pendingReport]Timer),
+	}
+}
+
+// add schedules a failed report to be resent, returning false if the queue is
+// full or closed, or the report has already been retried too many times.
+func (q *retryQueue) add(report *pendingReport) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed || len(q.pending) >= q.size || report.requeues >= maxRequeues {
+		return false
+	}
+
+	report.requeues++
+
+	// Exponential backoff, with jitter in the range [delay/2, delay).
+	delay := min(q.backoff<<(report.requeues-1), maxRequeueBackoff)
+	delay = delay/2 + rand.N(delay/2+1)
+
+	q.pending[report] = q.clock.AfterFunc(delay, func() {
+		q.mu.Lock()
+		_, ok := q.pending[report]
+		delete(q.pending, report)
+		q.mu.Unlock()
+
+		// Unless it was already drained or discarded.
+		if ok {
+			q.resend(report)
+		}
+	})
+
+	return true
+}
+
+// drain stops accepting failed reports, and resends every pending report
+// immediately.
+func (q *retryQueue) drain() {
+	for _, report := range q.close() {
+		q.resend(report)
+	}
+}
+
+// close stops accepting failed reports, and returns the pending reports
+// without resending them.
+func (q *retryQueue) close() []*pendingReport {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+
+	reports := make([]*pendingReport, 0, len(q.pending))
+	for report, timer := range q.pending {
+		timer.Stop()
+		reports = append(reports, report)
+	}
+	clear(q.pending)
+
+	return reports
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// The maximum number of distinct events merged within a window, any others
+// are reported as usual.
+const maxRollupEntries = 1024
+
+// rollupAggregator merges identical events (ignoring their timestamp and
+// session) reported within a window into a single event, carrying the number
+// of occurrences and when the first and last were seen. Unlike deduplication,
+// no occurrences are lost.
+type rollupAggregator struct {
+	clock   Clock
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*rollupEntry
+	// In the order they were first seen.
+	order [][sha256.Size]byte
+}
+
+type rollupEntry struct {
+	event     *v1alpha1.TelemetryEvent
+	count     int64
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+func newRollupAggregator(clock Clock) *rollupAggregator {
+	return &rollupAggregator{
+		clock:   clock,
+		entries: make(map[[sha256.Size]byte]*rollupEntry),
+	}
+}
+
+// add merges the event into the current window, it returns false if there are
+// already too many distinct events in the window.
+func (a *rollupAggregator) add(event *v1alpha1.TelemetryEvent) bool {
+	hash := hashEvent(event)
+
+	seen := a.clock.Now()
+	if event.Timestamp != nil {
+		seen = event.Timestamp.AsTime()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	entry, ok := a.entries[hash]
+	if !ok {
+		if len(a.entries) >= maxRollupEntries {
+			return false
+		}
+
+		entry = &rollupEntry{event: event, firstSeen: seen, lastSeen: seen}
+		a.entries[hash] = entry
+		a.order = append(a.order, hash)
+	}
+
+	entry.count++
+	if seen.Before(entry.firstSeen) {
+		entry.firstSeen = seen
+	}
+	if seen.After(entry.lastSeen) {
+		entry.lastSeen = seen
+	}
+
+	return true
+}
+
+// drain closes the current window, returning a merged event for each distinct
+// event seen within it.
+func (a *rollupAggregator) drain() []*v1alpha1.TelemetryEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.order) == 0 {
+		return nil
+	}
+
+	events := make([]*v1alpha1.TelemetryEvent, 0, len(a.order))
+	for _, hash := range a.order {
+		entry := a.entries[hash]
+
+		event := entry.event
+		event.Rollup = &v1alpha1.Rollup{
+			Count:     entry.count,
+			FirstSeen: timestamppb.New(entry.firstSeen),
+			LastSeen:  timestamppb.New(entry.lastSeen),
+		}
+		events = append(events, event)
+	}
+	clear(a.entries)
+	a.order = nil
+
+	return events
+}
+
+// flushRollups reports the events merged within the current window, unless
+// reporting has been disabled in the meantime.
+func (r *Reporter) flushRollups() {
+	if r.rollup == nil {
+		return
+	}
+
+	events := r.rollup.drain()
+	if !r.Enabled() {
+		return
+	}
+
+	for _, event := range events {
+		_ = r.enqueue(r.reportsCtx, event, false)
+	}
+}
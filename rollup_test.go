@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollup(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:      baseURL,
+		RollupWindow: time.Hour,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for i := 0; i < 100; i++ {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "retry"})
+	}
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "other"})
+
+	// Nothing is reported until the window closes.
+	require.Never(t, func() bool {
+		return len(svc.receivedEvents) > 0
+	}, 100*time.Millisecond, 10*time.Millisecond)
+
+	require.NoError(t, r.Flush(ctx))
+
+	events := map[string]*v1alpha1.TelemetryEvent{}
+	for len(svc.receivedEvents) > 0 {
+		ev := <-svc.receivedEvents
+		events[ev.Name] = ev
+	}
+	require.Len(t, events, 2)
+
+	rollup := events["retry"].Rollup
+	require.NotNil(t, rollup)
+	require.Equal(t, int64(100), rollup.Count)
+	require.False(t, rollup.LastSeen.AsTime().Before(rollup.FirstSeen.AsTime()))
+
+	require.Equal(t, int64(1), events["other"].Rollup.Count)
+
+	// Important events aren't merged.
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventImportant(&v1alpha1.TelemetryEvent{Name: "crash"}))
+	require.NoError(t, r.Flush(ctx))
+
+	ev := <-svc.receivedEvents
+	require.Equal(t, "crash", ev.Name)
+	require.Nil(t, ev.Rollup)
+}
+
+func TestRollupWindow(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:      baseURL,
+		RollupWindow: 50 * time.Millisecond,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	for i := 0; i < 10; i++ {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "retry"})
+	}
+
+	// Reported once the window closes, without a flush.
+	select {
+	case ev := <-svc.receivedEvents:
+		require.Equal(t, int64(10), ev.Rollup.Count)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for rolled up event")
+	}
+}
+
+func TestRollupInterceptor(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:      baseURL,
+		RollupWindow: time.Hour,
+		Interceptors: []telemetry.Interceptor{
+			func(next telemetry.SendFunc) telemetry.SendFunc {
+				return func(ctx context.Context, event *v1alpha1.TelemetryEvent) telemetry.Status {
+					if event.Name == "secret" {
+						return telemetry.StatusDroppedIntercepted
+					}
+					return next(ctx, event)
+				}
+			},
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	// Events are filtered before they're merged.
+	for i := 0; i < 10; i++ {
+		require.Equal(t, telemetry.StatusDroppedIntercepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "secret"}))
+		require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "public"}))
+	}
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, svc.receivedEvents, 1)
+	ev := <-svc.receivedEvents
+	require.Equal(t, "public", ev.Name)
+	require.Equal(t, int64(10), ev.Rollup.Count)
+}
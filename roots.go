@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"crypto/x509"
+	_ "embed"
+)
+
+//go:embed roots.pem
+var rootsPEM []byte
+
+// DefaultRootCAs is the pool of root certificates trusted by the default HTTP
+// client, when Configuration.RootCAs isn't set. It only contains the Let's
+// Encrypt roots, eg. ISRG Root X1 (DST Root CA X3) and ISRG Root X2 (ISRG Root
+// CA). It may be replaced (eg. by forks that need different roots) before
+// creating any reporters, it affects every reporter created afterwards.
+var DefaultRootCAs *x509.CertPool
+
+func init() {
+	DefaultRootCAs = x509.NewCertPool()
+	if ok := DefaultRootCAs.AppendCertsFromPEM(rootsPEM); !ok {
+		panic("failed to parse roots.pem")
+	}
+}
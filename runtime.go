@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"runtime"
+	"strconv"
+)
+
+// Reserved labels used to record runtime information.
+const (
+	osLabelKey        = "runtime_os"
+	archLabelKey      = "runtime_arch"
+	goVersionLabelKey = "runtime_go_version"
+	numCPULabelKey    = "runtime_num_cpu"
+)
+
+// runtimeLabels describes the platform the program is running on. Nothing
+// that could identify the host (eg. hostname, IP address) is included.
+func runtimeLabels() map[string]string {
+	return map[string]string{
+		osLabelKey:        runtime.GOOS,
+		archLabelKey:      runtime.GOARCH,
+		goVersionLabelKey: runtime.Version(),
+		numCPULabelKey:    strconv.Itoa(runtime.NumCPU()),
+	}
+}
@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+)
+
+// shouldSample returns true if the event should be reported given the sample
+// rate. When the event has a session id the decision is derived from a hash
+// of the session id and event name, so that all events of a given kind within
+// a session are either reported or dropped together.
+func shouldSample(rate float64, event *v1alpha1.TelemetryEvent) bool {
+	if rate >= 1 {
+		return true
+	}
+
+	if event.SessionId == "" {
+		return rand.Float64() < rate
+	}
+
+	h := sha256.New()
+	_, _ = h.Write([]byte(event.SessionId))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(event.Name))
+
+	return float64(binary.BigEndian.Uint64(h.Sum(nil)))/math.MaxUint64 < rate
+}
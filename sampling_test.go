@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampling(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:    baseURL,
+		SampleRate: 0.5,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	const n = 64
+	for i := 0; i < n; i++ {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: fmt.Sprintf("event-%d", i)})
+		require.NoError(t, r.Flush(ctx))
+	}
+
+	delivered := len(svc.receivedEvents)
+	require.NotZero(t, delivered)
+	require.NotZero(t, r.SampledOut())
+	require.Equal(t, uint64(n), uint64(delivered)+r.SampledOut())
+
+	// Sampling decisions are consistent within a session.
+	sampledOut := r.SampledOut()
+	for i := 0; i < 10; i++ {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "same"})
+	}
+
+	require.Contains(t, []uint64{sampledOut, sampledOut + 10}, r.SampledOut())
+}
+
+func TestReportEventImportant(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:    baseURL,
+		SampleRate: 0.0000001,
+		RateLimits: map[string]telemetry.RateLimit{
+			"crash": {Rate: 0.0001, Burst: 1},
+		},
+		BatchSize:     10,
+		BatchInterval: time.Hour,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.Equal(t, telemetry.StatusDroppedSampled, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "crash"}))
+
+	for i := 0; i < 2; i++ {
+		require.Equal(t, telemetry.StatusAccepted, r.ReportEventImportant(&v1alpha1.TelemetryEvent{Name: "crash"}))
+	}
+
+	// Important events aren't held back for batching.
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-svc.receivedEvents:
+			require.Equal(t, "crash", event.Name)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for important event")
+		}
+	}
+
+	r.SetEnabled(false)
+	require.Equal(t, telemetry.StatusDroppedDisabled, r.ReportEventImportant(&v1alpha1.TelemetryEvent{Name: "crash"}))
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"slices"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+)
+
+var _ ReporterInterface = (*ScopedReporter)(nil)
+
+// ScopedReporter adds its own tags to every event, before reporting it with
+// the Reporter it was derived from (sharing its queue, client, and session).
+// The parent owns the lifecycle, so Shutdown and Close are no-ops.
+type ScopedReporter struct {
+	parent *Reporter
+	tags   []string
+}
+
+// WithTags returns a scoped reporter that adds the given tags to every event,
+// eg. to identify a subsystem.
+func (r *Reporter) WithTags(tags ...string) *ScopedReporter {
+	return &ScopedReporter{
+		parent: r,
+		tags:   slices.Clone(tags),
+	}
+}
+
+// WithTags returns a scoped reporter that adds the given tags to every event,
+// in addition to those of this scoped reporter.
+func (s *ScopedReporter) WithTags(tags ...string) *ScopedReporter {
+	return &ScopedReporter{
+		parent: s.parent,
+		tags:   append(slices.Clone(s.tags), tags...),
+	}
+}
+
+// ReportEvent reports a telemetry event, see Reporter.ReportEvent.
+func (s *ScopedReporter) ReportEvent(event *v1alpha1.TelemetryEvent) {
+	s.parent.ReportEvent(s.scope(event))
+}
+
+// ReportEventContext reports a telemetry event, respecting cancellation of
+// ctx, see Reporter.ReportEventContext.
+func (s *ScopedReporter) ReportEventContext(ctx context.Context, event *v1alpha1.TelemetryEvent) {
+	s.parent.ReportEventContext(ctx, s.scope(event))
+}
+
+// ReportEventResult reports a telemetry event, returning the outcome, see
+// Reporter.ReportEventResult.
+func (s *ScopedReporter) ReportEventResult(event *v1alpha1.TelemetryEvent) Status {
+	return s.parent.ReportEventResult(s.scope(event))
+}
+
+// ReportEventImportant reports a high-value telemetry event, see
+// Reporter.ReportEventImportant.
+func (s *ScopedReporter) ReportEventImportant(event *v1alpha1.TelemetryEvent) Status {
+	return s.parent.ReportEventImportant(s.scope(event))
+}
+
+// Flush blocks until all of the parent's pending events have been reported.
+func (s *ScopedReporter) Flush(ctx context.Context) error {
+	return s.parent.Flush(ctx)
+}
+
+// Shutdown does nothing, the parent must be shut down instead.
+func (s *ScopedReporter) Shutdown(_ context.Context) error {
+	return nil
+}
+
+// Close does nothing, the parent must be closed instead.
+func (s *ScopedReporter) Close() error {
+	return nil
+}
+
+// scope adds the scoped tags to an event.
+func (s *ScopedReporter) scope(event *v1alpha1.TelemetryEvent) *v1alpha1.TelemetryEvent {
+	event.Tags = append(event.Tags, s.tags...)
+	return event
+}
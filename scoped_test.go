@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTags(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+		Tags:    []string{"root"},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	dns := r.WithTags("dns")
+	resolver := dns.WithTags("resolver")
+
+	require.Equal(t, telemetry.StatusAccepted, resolver.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "lookup_failed"}))
+
+	// Closing a scoped reporter doesn't affect the parent.
+	require.NoError(t, dns.Shutdown(ctx))
+	require.NoError(t, dns.Close())
+
+	dns.ReportEvent(&v1alpha1.TelemetryEvent{Name: "cache_miss"})
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "started"})
+
+	require.NoError(t, resolver.Flush(ctx))
+
+	tags := map[string][]string{}
+	for len(svc.receivedEvents) > 0 {
+		ev := <-svc.receivedEvents
+		require.Equal(t, r.SessionID(), ev.SessionId)
+		tags[ev.Name] = ev.Tags
+	}
+
+	require.Equal(t, map[string][]string{
+		"lookup_failed": {"dns", "resolver", "root"},
+		"cache_miss":    {"dns", "root"},
+		"started":       {"root"},
+	}, tags)
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/noisysockets/telemetry/internal/util"
+)
+
+// session tracks the current session id, rotating it once the session TTL has
+// elapsed. Rotation is lazy, eg. it happens when the id is next requested.
+type session struct {
+	mu         sync.Mutex
+	clock      Clock
+	ttl        time.Duration
+	id         string
+	previousID string
+	started    time.Time
+	// The sequence number of the last event in the current session.
+	sequence uint64
+}
+
+const (
+	// The maximum length of a caller supplied session id.
+	maxSessionIDLength = 128
+	// The salt mixed into stable session ids, so that the ids can't be
+	// matched against hashes of known machine identifiers.
+	stableIDSalt = "f3c1b7e0-noisysockets-telemetry"
+	// The length of stable session ids, in hex characters.
+	stableIDLength = 16
+)
+
+// newSession creates a new session, using the given id if non-empty.
+func newSession(clock Clock, ttl time.Duration, id string) *session {
+	if id == "" {
+		id = util.GenerateID(16)
+	}
+
+	return &session{
+		clock:   clock,
+		ttl:     ttl,
+		id:      id,
+		started: clock.Now(),
+	}
+}
+
+// current returns the current session id, and the id of the session it
+// replaced (if any).
+func (s *session) current() (id, previousID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ttl > 0 {
+		if now := s.clock.Now(); now.Sub(s.started) >= s.ttl {
+			s.previousID = s.id
+			s.id = util.GenerateID(16)
+			s.started = now
+			s.sequence = 0
+		}
+	}
+
+	return s.id, s.previousID
+}
+
+// nextSequence returns the next sequence number of the given session, or 0 if
+// it's not the current session (eg. it was rotated, or set by the caller).
+func (s *session) nextSequence(id string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id != s.id {
+		return 0
+	}
+
+	s.sequence++
+	return s.sequence
+}
+
+// stableSessionID derives a session id from a stable machine identifier.
+func stableSessionID(seed string) string {
+	sum := sha256.Sum256([]byte(seed + stableIDSalt))
+	return hex.EncodeToString(sum[:])[:stableIDLength]
+}
+
+// validSessionID checks that a caller supplied session id is non-empty, not
+// excessively long, and only contains printable characters.
+func validSessionID(id string) bool {
+	if id == "" || len(id) > maxSessionIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		if !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return false
+		}
+	}
+
+	return true
+}
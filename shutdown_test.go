@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepeatedShutdown(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	newReporter := func() *telemetry.Reporter {
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:             baseURL,
+			BatchSize:           10,
+			EmitLifecycleEvents: true,
+		})
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		return r
+	}
+
+	t.Run("Shutdown Then Close", func(t *testing.T) {
+		r := newReporter()
+		require.NoError(t, r.Shutdown(ctx))
+		require.NoError(t, r.Shutdown(ctx))
+		require.NoError(t, r.Close())
+	})
+
+	t.Run("Close Then Close", func(t *testing.T) {
+		r := newReporter()
+		require.NoError(t, r.Close())
+		require.NoError(t, r.Close())
+		require.NoError(t, r.Shutdown(ctx))
+	})
+
+	t.Run("Concurrent Shutdown", func(t *testing.T) {
+		r := newReporter()
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- r.Shutdown(ctx)
+			}()
+		}
+		wg.Wait()
+
+		require.NoError(t, <-errs)
+		require.NoError(t, <-errs)
+		require.NoError(t, r.Close())
+	})
+}
+
+func TestCancelContext(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	goroutines := runtime.NumGoroutine()
+
+	reporterCtx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+
+	r := telemetry.NewReporter(reporterCtx, logger, telemetry.Configuration{
+		BaseURL:       baseURL,
+		BatchSize:     10,
+		FlushInterval: time.Minute,
+		RollupWindow:  time.Minute,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+
+	cancel()
+
+	// The reporter is torn down, as if closed.
+	require.Eventually(t, func() bool {
+		return r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}) == telemetry.StatusDroppedShuttingDown
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// And its background goroutines exit (not using require.Eventually, as
+	// it runs the condition in a goroutine of its own).
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > goroutines {
+		require.True(t, time.Now().Before(deadline), "background goroutines didn't exit")
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,190 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"connectrpc.com/connect"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1/v1alpha1connect"
+)
+
+// Sink is a destination for telemetry events, eg. a file or a message queue.
+// By default events are sent to the telemetry server. Sinks must be safe for
+// concurrent use.
+type Sink interface {
+	// Send delivers a single telemetry event.
+	Send(ctx context.Context, event *v1alpha1.TelemetryEvent) error
+}
+
+// BatchSink is a Sink that can deliver multiple events at once. Batches sent
+// to sinks that don't implement it are delivered one event at a time.
+type BatchSink interface {
+	Sink
+	// SendBatch delivers a batch of telemetry events.
+	SendBatch(ctx context.Context, events []*v1alpha1.TelemetryEvent) error
+}
+
+// SinkFunc is an adapter to allow the use of ordinary functions as a Sink.
+type SinkFunc func(ctx context.Context, event *v1alpha1.TelemetryEvent) error
+
+// Send calls f(ctx, event).
+func (f SinkFunc) Send(ctx context.Context, event *v1alpha1.TelemetryEvent) error {
+	return f(ctx, event)
+}
+
+// SinkError is passed to the OnError hook when events fail to be delivered to
+// one of several sinks (see Configuration.Sinks).
+type SinkError struct {
+	// Sink is the name of the sink.
+	Sink string
+	Err  error
+}
+
+func (e *SinkError) Error() string {
+	return "sink " + e.Sink + ": " + e.Err.Error()
+}
+
+func (e *SinkError) Unwrap() error {
+	return e.Err
+}
+
+// namedSink is a sink and its name, which is empty unless there are several.
+type namedSink struct {
+	Sink
+	name string
+}
+
+// sendToSink delivers events to the sink, in a single batch if supported.
+func sendToSink(ctx context.Context, sink Sink, events []*v1alpha1.TelemetryEvent) error {
+	if batchSink, ok := sink.(BatchSink); ok {
+		return batchSink.SendBatch(ctx, events)
+	}
+
+	for _, event := range events {
+		if err := sink.Send(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var _ BatchSink = (*connectSink)(nil)
+
+// connectSink sends events to the telemetry server. If the server is
+// unreachable, each of the fallback servers is tried in turn.
+type connectSink struct {
+	clients    []v1alpha1connect.TelemetryClient
+	setHeaders func(ctx context.Context, header http.Header) error
+	// If streaming, the stream to each of the servers, and a function
+	// called with the outcome of streamed events once known.
+	streams []*eventStream
+	settle  func(events []*v1alpha1.TelemetryEvent, err error)
+}
+
+func (s *connectSink) Send(ctx context.Context, event *v1alpha1.TelemetryEvent) error {
+	return s.SendBatch(ctx, []*v1alpha1.TelemetryEvent{event})
+}
+
+func (s *connectSink) SendBatch(ctx context.Context, events []*v1alpha1.TelemetryEvent) error {
+	var err error
+	for i, client := range s.clients {
+		// Writing nothing to a stream wouldn't contact the server, so empty
+		// batches (eg. pings) are always sent with a unary request.
+		if s.streams != nil && len(events) > 0 {
+			err = s.streamTo(ctx, i, events)
+		} else {
+			err = s.sendTo(ctx, client, events)
+		}
+		if connect.CodeOf(err) != connect.CodeUnavailable {
+			return err
+		}
+	}
+
+	return err
+}
+
+// streamTo sends events over the stream to the i-th server, falling back to
+// unary requests if it doesn't support streaming. Either way, the outcome of
+// the events is settled once known, but if an error is returned, the given
+// events are left to the caller.
+func (s *connectSink) streamTo(ctx context.Context, i int, events []*v1alpha1.TelemetryEvent) error {
+	unsent, err := s.streams[i].send(ctx, events)
+	if !errors.Is(err, errStreamingUnsupported) {
+		return err
+	}
+
+	// Previously written events come first.
+	if err = s.sendTo(ctx, s.clients[i], unsent); err != nil {
+		s.settle(unsent[:len(unsent)-len(events)], err)
+		return err
+	}
+
+	s.settle(unsent, nil)
+
+	return nil
+}
+
+// closeStreams closes any open streams, settling the events written to them.
+// It returns an error if any of the events may not have been received.
+func (s *connectSink) closeStreams(ctx context.Context) error {
+	var errs []error
+	for i, stream := range s.streams {
+		unsent, err := stream.close()
+		if errors.Is(err, errStreamingUnsupported) {
+			if len(unsent) == 0 {
+				continue
+			}
+
+			err = s.sendTo(ctx, s.clients[i], unsent)
+			s.settle(unsent, err)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// abortStreams closes any open streams without waiting for confirmation,
+// no more can be opened afterwards.
+func (s *connectSink) abortStreams() {
+	for _, stream := range s.streams {
+		stream.abort()
+	}
+}
+
+func (s *connectSink) sendTo(ctx context.Context, client v1alpha1connect.TelemetryClient, events []*v1alpha1.TelemetryEvent) error {
+	if len(events) == 1 {
+		req := &connect.Request[v1alpha1.TelemetryEvent]{Msg: events[0]}
+		if err := s.setHeaders(ctx, req.Header()); err != nil {
+			return err
+		}
+
+		_, err := client.Report(ctx, req)
+		return err
+	}
+
+	req := &connect.Request[v1alpha1.TelemetryEventBatch]{
+		Msg: &v1alpha1.TelemetryEventBatch{Events: events},
+	}
+	if err := s.setHeaders(ctx, req.Header()); err != nil {
+		return err
+	}
+
+	_, err := client.BatchReport(ctx, req)
+	return err
+}
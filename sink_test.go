@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSink(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	t.Run("Single", func(t *testing.T) {
+		sink := &recordingSink{}
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			Sink:      sink,
+			BatchSize: 2,
+			Tags:      []string{"test"},
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		t.Cleanup(cancel)
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "a"})
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "b"})
+		require.NoError(t, r.Flush(ctx))
+
+		// Batches are delivered one event at a time.
+		events := sink.recorded()
+		require.Len(t, events, 2)
+		require.ElementsMatch(t, []string{"a", "b"}, []string{events[0].Name, events[1].Name})
+		require.Equal(t, []string{"test"}, events[0].Tags)
+		require.Equal(t, r.SessionID(), events[0].SessionId)
+
+		require.NoError(t, r.Ping(ctx))
+		require.Len(t, sink.recorded(), 2)
+	})
+
+	t.Run("Batch", func(t *testing.T) {
+		sink := &recordingBatchSink{}
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			Sink:      sink,
+			BatchSize: 2,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		t.Cleanup(cancel)
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "a"})
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "b"})
+		require.NoError(t, r.Flush(ctx))
+
+		require.Equal(t, []int{2}, sink.batchSizes())
+	})
+}
+
+func TestSinks(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	healthy := &recordingSink{}
+	errs := make(chan error, 10)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		Sinks: map[string]telemetry.Sink{
+			"healthy": healthy,
+			"broken": telemetry.SinkFunc(func(_ context.Context, _ *v1alpha1.TelemetryEvent) error {
+				return errors.New("broken")
+			}),
+		},
+		OnError: func(_ *v1alpha1.TelemetryEvent, err error) {
+			errs <- err
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Flush(ctx))
+
+	// The event still reaches the healthy sink.
+	events := healthy.recorded()
+	require.Len(t, events, 1)
+	require.Equal(t, "test", events[0].Name)
+	require.Equal(t, uint64(1), r.Stats().DeliveredOK)
+
+	require.Len(t, errs, 1)
+	var sinkErr *telemetry.SinkError
+	require.ErrorAs(t, <-errs, &sinkErr)
+	require.Equal(t, "broken", sinkErr.Sink)
+}
+
+// recordingSink is a Sink that records the events it's sent.
+type recordingSink struct {
+	mu     sync.Mutex
+	events []*v1alpha1.TelemetryEvent
+}
+
+func (s *recordingSink) Send(_ context.Context, event *v1alpha1.TelemetryEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingSink) recorded() []*v1alpha1.TelemetryEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*v1alpha1.TelemetryEvent(nil), s.events...)
+}
+
+// recordingBatchSink is a BatchSink that records the size of the batches it's
+// sent.
+type recordingBatchSink struct {
+	recordingSink
+	sizes []int
+}
+
+func (s *recordingBatchSink) SendBatch(_ context.Context, events []*v1alpha1.TelemetryEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, events...)
+	s.sizes = append(s.sizes, len(events))
+	return nil
+}
+
+func (s *recordingBatchSink) batchSizes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]int(nil), s.sizes...)
+}
@@ -0,0 +1,252 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/internal/util"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// The default maximum size of the spool directory.
+	defaultSpoolMaxBytes = 1 << 20
+	// The file extension used for spooled events.
+	spoolFileExt = ".pb"
+	// Appended to the name of a spooled file while it's being replayed.
+	spoolClaimedSuffix = ".claimed-"
+	// How long a file can stay claimed before it's assumed that the process
+	// replaying it crashed, and it's returned to the spool.
+	spoolStaleClaimAge = time.Minute
+)
+
+// spool persists unsent events to disk so they can be replayed later.
+// Each file contains a single protobuf-encoded batch of events. Files are
+// named after the time they were written so that they sort oldest first.
+//
+// The spool is safe to share between processes: files are written atomically
+// (by renaming a temporary file into place), and are claimed for replay by
+// renaming them, which only one process can do successfully. Files left
+// claimed by a process that crashed are returned to the spool by the next
+// reporter to open it.
+type spool struct {
+	clock    Clock
+	dir      string
+	maxBytes int64
+	// Serializes pruning within a process.
+	mu sync.Mutex
+}
+
+func newSpool(clock Clock, dir string, maxBytes int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	if maxBytes <= 0 {
+		maxBytes = defaultSpoolMaxBytes
+	}
+
+	s := &spool{
+		clock:    clock,
+		dir:      dir,
+		maxBytes: maxBytes,
+	}
+
+	if err := s.unclaimStale(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// write persists the given events to the spool, pruning the oldest files if
+// the spool is full.
+func (s *spool) write(events []*v1alpha1.TelemetryEvent) error {
+	data, err := proto.Marshal(&v1alpha1.TelemetryEventBatch{Events: events})
+	if err != nil {
+		return fmt.Errorf("failed to marshal events: %w", err)
+	}
+
+	f, err := os.CreateTemp(s.dir, "*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create spool file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(f.Name())
+	}()
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close spool file: %w", err)
+	}
+
+	name := fmt.Sprintf("%020d-%s%s", s.clock.Now().UnixNano(), util.GenerateID(8), spoolFileExt)
+	if err := os.Rename(f.Name(), filepath.Join(s.dir, name)); err != nil {
+		return fmt.Errorf("failed to rename spool file: %w", err)
+	}
+
+	return s.prune()
+}
+
+// claim removes up to max of the oldest files from the spool, returning the
+// events they contained.
+func (s *spool) claim(max int) ([][]*v1alpha1.TelemetryEvent, error) {
+	files, err := s.list(false)
+	if err != nil {
+		return nil, err
+	}
+
+	var batches [][]*v1alpha1.TelemetryEvent
+	for _, file := range files {
+		if len(batches) >= max {
+			break
+		}
+
+		// Claim the file by renaming it, if another process got there first
+		// the rename will fail.
+		path := filepath.Join(s.dir, file.Name())
+		claimedPath := path + spoolClaimedSuffix + util.GenerateID(8)
+		if err := os.Rename(path, claimedPath); err != nil {
+			continue
+		}
+
+		// Record when it was claimed, so that it can be recovered if we crash.
+		_ = os.Chtimes(claimedPath, time.Time{}, s.clock.Now())
+
+		data, err := os.ReadFile(claimedPath)
+		_ = os.Remove(claimedPath)
+		if err != nil {
+			return batches, fmt.Errorf("failed to read spool file: %w", err)
+		}
+
+		var batch v1alpha1.TelemetryEventBatch
+		if err := proto.Unmarshal(data, &batch); err != nil {
+			// Corrupted, nothing we can do with it.
+			continue
+		}
+
+		batches = append(batches, batch.Events)
+	}
+
+	return batches, nil
+}
+
+// unclaimStale returns files that have been claimed for too long to the spool,
+// so that they're replayed again.
+func (s *spool) unclaimStale() error {
+	files, err := s.list(true)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		name, ok := unclaimedName(file.Name())
+		if !ok || s.clock.Now().Sub(file.ModTime()) < spoolStaleClaimAge {
+			continue
+		}
+
+		// Unless another process got there first.
+		_ = os.Rename(filepath.Join(s.dir, file.Name()), filepath.Join(s.dir, name))
+	}
+
+	return nil
+}
+
+// prune removes the oldest files (including those claimed for replay) until
+// the spool is within its size limit.
+func (s *spool) prune() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.list(true)
+	if err != nil {
+		return err
+	}
+
+	var totalBytes int64
+	for _, file := range files {
+		totalBytes += file.Size()
+	}
+
+	for _, file := range files {
+		if totalBytes <= s.maxBytes {
+			break
+		}
+
+		err := os.Remove(filepath.Join(s.dir, file.Name()))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove spool file: %w", err)
+		}
+
+		totalBytes -= file.Size()
+	}
+
+	return nil
+}
+
+// list returns the spooled files, oldest first, optionally including those
+// claimed for replay.
+func (s *spool) list(includeClaimed bool) ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	var files []fs.FileInfo
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		_, claimed := unclaimedName(entry.Name())
+		if !strings.HasSuffix(entry.Name(), spoolFileExt) && (!claimed || !includeClaimed) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// Removed by another process.
+			continue
+		}
+
+		files = append(files, info)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+
+	return files, nil
+}
+
+// unclaimedName returns the original name of a file claimed for replay, or
+// false if the file isn't claimed.
+func unclaimedName(name string) (string, bool) {
+	i := strings.LastIndex(name, spoolFileExt+spoolClaimedSuffix)
+	if i < 0 {
+		return "", false
+	}
+
+	return name[:i+len(spoolFileExt)], true
+}
@@ -0,0 +1,227 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpool(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	spoolDir := t.TempDir()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	// Report an event while "offline".
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:  "http://" + deadAddr(t),
+		SpoolDir: spoolDir,
+	})
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "offline"})
+	require.NoError(t, r.Shutdown(ctx))
+	require.NoError(t, r.Close())
+
+	entries, err := os.ReadDir(spoolDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	// The next reporter should replay the spooled event.
+	r = telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:  baseURL,
+		SpoolDir: spoolDir,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.NoError(t, r.Flush(ctx))
+
+	ev := <-svc.receivedEvents
+	require.Equal(t, "offline", ev.Name)
+	require.True(t, ev.Timestamp.AsTime().Before(time.Now().Add(-100*time.Millisecond)))
+
+	entries, err = os.ReadDir(spoolDir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestSpoolStaleClaim(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	spoolDir := t.TempDir()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:  "http://" + deadAddr(t),
+		SpoolDir: spoolDir,
+	})
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "offline"})
+	require.NoError(t, r.Shutdown(ctx))
+	require.NoError(t, r.Close())
+
+	entries, err := os.ReadDir(spoolDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// Simulate a process that crashed while replaying the file.
+	path := filepath.Join(spoolDir, entries[0].Name())
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	stalePath := path + ".claimed-stale"
+	require.NoError(t, os.Rename(path, stalePath))
+	require.NoError(t, os.Chtimes(stalePath, time.Time{}, time.Now().Add(-time.Hour)))
+
+	// And another that is still replaying its file.
+	activePath := path + ".claimed-active"
+	require.NoError(t, os.WriteFile(activePath, data, 0o600))
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	// The next reporter should replay the stale file only.
+	r = telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:  baseURL,
+		SpoolDir: spoolDir,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, svc.receivedEvents, 1)
+	require.Equal(t, "offline", (<-svc.receivedEvents).Name)
+
+	entries, err = os.ReadDir(spoolDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, filepath.Base(activePath), entries[0].Name())
+}
+
+func TestSpoolMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	spoolDir := t.TempDir()
+
+	// Claimed files count towards the size limit too.
+	claimedPath := filepath.Join(spoolDir, "00000000000000000000-claimed.pb.claimed-crashed")
+	require.NoError(t, os.WriteFile(claimedPath, make([]byte, 150), 0o600))
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:       "http://" + deadAddr(t),
+		SpoolDir:      spoolDir,
+		SpoolMaxBytes: 200,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for i := 0; i < 5; i++ {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test", Message: "an event that takes up some space"})
+		require.NoError(t, r.Flush(ctx))
+	}
+
+	entries, err := os.ReadDir(spoolDir)
+	require.NoError(t, err)
+
+	var totalBytes int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		require.NoError(t, err)
+
+		totalBytes += info.Size()
+	}
+
+	require.NotEmpty(t, entries)
+	require.LessOrEqual(t, totalBytes, int64(200))
+	require.NoFileExists(t, claimedPath)
+}
+
+func TestDrainSpoolOnShutdown(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for _, drain := range []bool{false, true} {
+		spoolDir := t.TempDir()
+
+		// The first report fails and is spooled.
+		svc := &failingSvc{mockSvc: newMockSvc(), code: connect.CodeUnavailable}
+		svc.failures.Store(1)
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL:              baseURL,
+			SpoolDir:             spoolDir,
+			DrainSpoolOnShutdown: drain,
+		})
+		t.Cleanup(func() {
+			require.NoError(t, r.Close())
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "spooled"})
+		require.NoError(t, r.Flush(ctx))
+		require.Empty(t, svc.receivedEvents)
+
+		require.NoError(t, r.Shutdown(ctx))
+
+		entries, err := os.ReadDir(spoolDir)
+		require.NoError(t, err)
+
+		if drain {
+			require.Len(t, svc.receivedEvents, 1)
+			require.Equal(t, "spooled", (<-svc.receivedEvents).Name)
+			require.Empty(t, entries)
+		} else {
+			require.Empty(t, svc.receivedEvents)
+			require.Len(t, entries, 1)
+		}
+	}
+}
+
+// deadAddr returns the address of a port that nothing is listening on.
+func deadAddr(t *testing.T) string {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	addr := lis.Addr().String()
+	require.NoError(t, lis.Close())
+
+	return addr
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// The payload key of the stack trace of error events.
+	stackPayloadKey = "stack"
+	// The maximum number of frames captured, to bound the size of events.
+	maxStackFrames = 32
+	// The replacement for GOPATH prefixes.
+	redactedGOPATH = "$GOPATH"
+)
+
+// CaptureStack returns the stack trace of the calling goroutine, scrubbed of
+// personally identifiable information (see ScrubStack). At most 32 frames are
+// captured.
+func CaptureStack() string {
+	return captureStack(1)
+}
+
+// captureStack captures the stack, skipping the given number of frames above
+// its caller.
+func captureStack(skip int) string {
+	pc := make([]uintptr, maxStackFrames)
+	n := runtime.Callers(skip+2, pc)
+	frames := runtime.CallersFrames(pc[:n])
+
+	var sb strings.Builder
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+
+	return ScrubStack(sb.String())
+}
+
+// ScrubStack removes personally identifiable information from a stack trace
+// (eg. from debug.Stack), by replacing GOPATH prefixes with "$GOPATH", and the
+// user's home directory with "~", before applying RedactPII.
+func ScrubStack(stack string) string {
+	home, _ := os.UserHomeDir()
+
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" && home != "" {
+		gopath = filepath.Join(home, "go")
+	}
+
+	// GOPATH is often within the home directory, so it's replaced first.
+	for _, dir := range filepath.SplitList(gopath) {
+		stack = replacePathPrefix(stack, dir, redactedGOPATH)
+	}
+	stack = replacePathPrefix(stack, home, "~")
+
+	stack, _ = RedactPII("", stack)
+
+	return stack
+}
+
+// replacePathPrefix replaces every occurrence of dir (as a whole path
+// component) in s with the replacement.
+func replacePathPrefix(s, dir, replacement string) string {
+	dir = strings.TrimRight(dir, `/\`)
+	// Never replace the root directory.
+	if dir == "" || filepath.Dir(dir) == dir {
+		return s
+	}
+
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, dir)
+		if i < 0 {
+			break
+		}
+
+		end := i + len(dir)
+		if end < len(s) && s[end] != '/' && s[end] != '\\' && s[end] != ':' && s[end] != '\n' {
+			// Only part of a path component, eg. "/home/al" in "/home/alice".
+			sb.WriteString(s[:end])
+		} else {
+			sb.WriteString(s[:i])
+			sb.WriteString(replacement)
+		}
+		s = s[end:]
+	}
+	sb.WriteString(s)
+
+	return sb.String()
+}
+
+// ReportError reports an error event with the given name, with the error as
+// its message, and the caller's stack trace in its payload (under "stack").
+// Both are scrubbed of personally identifiable information, see ScrubStack.
+func (r *Reporter) ReportError(name string, err error) Status {
+	var message string
+	if err != nil {
+		message = ScrubStack(err.Error())
+	}
+
+	payload, _ := structpb.NewStruct(map[string]any{
+		stackPayloadKey: captureStack(1),
+	})
+
+	return r.ReportEventResult(&v1alpha1.TelemetryEvent{
+		Kind:    v1alpha1.TelemetryEventKind_ERROR,
+		Name:    name,
+		Message: message,
+		Payload: payload,
+	})
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrubStack(t *testing.T) {
+	t.Setenv("HOME", "/var/lib/alice")
+	t.Setenv("GOPATH", "/var/lib/alice/gopath")
+
+	stack := `main.run()
+	/var/lib/alice/src/app/main.go:42 +0x1d
+github.com/noisysockets/telemetry.(*Reporter).ReportError(...)
+	/var/lib/alice/gopath/pkg/mod/github.com/noisysockets/telemetry@v0.1.0/stack.go:10
+main.helper()
+	/home/bob/src/app/helper.go:7
+runtime.main()
+	/usr/local/go/src/runtime/proc.go:271
+main.other()
+	/var/lib/alice2/src/other.go:3
+`
+
+	require.Equal(t, `main.run()
+	~/src/app/main.go:42 +0x1d
+github.com/noisysockets/telemetry.(*Reporter).ReportError(...)
+	$GOPATH/pkg/mod/github.com/noisysockets/telemetry@v0.1.0/stack.go:10
+main.helper()
+	~/src/app/helper.go:7
+runtime.main()
+	/usr/local/go/src/runtime/proc.go:271
+main.other()
+	/var/lib/alice2/src/other.go:3
+`, telemetry.ScrubStack(stack))
+}
+
+func TestCaptureStack(t *testing.T) {
+	t.Setenv("HOME", "/nonexistent")
+
+	stack := telemetry.CaptureStack()
+	require.Contains(t, stack, "telemetry_test.TestCaptureStack")
+	require.NotContains(t, stack, "telemetry.CaptureStack")
+}
+
+func TestReportError(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	t.Setenv("HOME", "/home/alice")
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	status := r.ReportError("open_failed", errors.New("open /home/alice/.config/nsh.yaml: permission denied"))
+	require.Equal(t, telemetry.StatusAccepted, status)
+	require.NoError(t, r.Flush(ctx))
+
+	ev := <-svc.receivedEvents
+	require.Equal(t, v1alpha1.TelemetryEventKind_ERROR, ev.Kind)
+	require.Equal(t, "open_failed", ev.Name)
+	require.Equal(t, "open ~/.config/nsh.yaml: permission denied", ev.Message)
+	require.Contains(t, ev.Payload.Fields["stack"].GetStringValue(), "telemetry_test.TestReportError")
+}
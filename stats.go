@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the reporter's event counters.
+type Stats struct {
+	// Accepted is the number of events accepted for reporting.
+	Accepted uint64
+	// DeliveredOK is the number of events successfully delivered.
+	DeliveredOK uint64
+	// FailedSend is the number of events that could not be delivered.
+	FailedSend uint64
+	// DroppedOverflow is the number of events dropped due to too many
+	// pending reports.
+	DroppedOverflow uint64
+	// DroppedDisabled is the number of events dropped because telemetry was
+	// disabled.
+	DroppedDisabled uint64
+	// DroppedShuttingDown is the number of events dropped because the
+	// reporter was shutting down.
+	DroppedShuttingDown uint64
+	// DroppedSampled is the number of events dropped by sampling.
+	DroppedSampled uint64
+	// DroppedRateLimited is the number of events dropped by rate limiting.
+	DroppedRateLimited uint64
+	// DroppedCircuitOpen is the number of events dropped while reporting was
+	// paused after repeated failures.
+	DroppedCircuitOpen uint64
+	// DroppedDuplicate is the number of events suppressed as duplicates.
+	DroppedDuplicate uint64
+	// DroppedInvalid is the number of events dropped by validation.
+	DroppedInvalid uint64
+	// DroppedCanceled is the number of events dropped because the caller's
+	// context was done.
+	DroppedCanceled uint64
+	// DroppedIntercepted is the number of events dropped by interceptors.
+	DroppedIntercepted uint64
+	// Reports is the number of reports sent to the telemetry server, each of
+	// which may contain multiple events.
+	Reports uint64
+	// ReportRate is the average number of reports sent per second, since
+	// the reporter was created.
+	ReportRate float64
+	// PausedUntil is when reporting resumes, if the telemetry server has
+	// asked us to back off (eg. with a 429 Too Many Requests response and a
+	// Retry-After header). Zero if reporting isn't paused.
+	PausedUntil time.Time
+	// InFlightBytes is the total serialized size of the pending reports, both
+	// queued and in-flight, see Configuration.MaxInFlightBytes.
+	InFlightBytes uint64
+}
+
+// stats holds the reporter's event counters.
+type stats struct {
+	accepted            atomic.Uint64
+	deliveredOK         atomic.Uint64
+	failedSend          atomic.Uint64
+	droppedOverflow     atomic.Uint64
+	droppedDisabled     atomic.Uint64
+	droppedShuttingDown atomic.Uint64
+	droppedSampled      atomic.Uint64
+	droppedRateLimited  atomic.Uint64
+	droppedCircuitOpen  atomic.Uint64
+	droppedDuplicate    atomic.Uint64
+	droppedInvalid      atomic.Uint64
+	droppedCanceled     atomic.Uint64
+	droppedIntercepted  atomic.Uint64
+	reports             atomic.Uint64
+}
+
+// record increments the counter corresponding to the given status.
+func (s *stats) record(status Status) {
+	switch status {
+	case StatusAccepted:
+		s.accepted.Add(1)
+	case StatusDroppedDisabled:
+		s.droppedDisabled.Add(1)
+	case StatusDroppedShuttingDown:
+		s.droppedShuttingDown.Add(1)
+	case StatusDroppedOverflow:
+		s.droppedOverflow.Add(1)
+	case StatusDroppedSampled:
+		s.droppedSampled.Add(1)
+	case StatusDroppedRateLimited:
+		s.droppedRateLimited.Add(1)
+	case StatusDroppedCircuitOpen:
+		s.droppedCircuitOpen.Add(1)
+	case StatusDroppedDuplicate:
+		s.droppedDuplicate.Add(1)
+	case StatusDroppedInvalid:
+		s.droppedInvalid.Add(1)
+	case StatusDroppedCanceled:
+		s.droppedCanceled.Add(1)
+	case StatusDroppedIntercepted:
+		s.droppedIntercepted.Add(1)
+	}
+}
+
+func (s *stats) snapshot() Stats {
+	return Stats{
+		Accepted:            s.accepted.Load(),
+		DeliveredOK:         s.deliveredOK.Load(),
+		FailedSend:          s.failedSend.Load(),
+		DroppedOverflow:     s.droppedOverflow.Load(),
+		DroppedDisabled:     s.droppedDisabled.Load(),
+		DroppedShuttingDown: s.droppedShuttingDown.Load(),
+		DroppedSampled:      s.droppedSampled.Load(),
+		DroppedRateLimited:  s.droppedRateLimited.Load(),
+		DroppedCircuitOpen:  s.droppedCircuitOpen.Load(),
+		DroppedDuplicate:    s.droppedDuplicate.Load(),
+		DroppedInvalid:      s.droppedInvalid.Load(),
+		DroppedCanceled:     s.droppedCanceled.Load(),
+		DroppedIntercepted:  s.droppedIntercepted.Load(),
+		Reports:             s.reports.Load(),
+	}
+}
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+// Status is the outcome of reporting an event.
+type Status int
+
+const (
+	// StatusAccepted means the event was accepted for reporting.
+	StatusAccepted Status = iota
+	// StatusDroppedDisabled means the event was dropped because telemetry
+	// is disabled.
+	StatusDroppedDisabled
+	// StatusDroppedShuttingDown means the event was dropped because the
+	// reporter is shutting down (or closed).
+	StatusDroppedShuttingDown
+	// StatusDroppedOverflow means the event was dropped because there were
+	// too many pending reports. If a spool is configured, the event will have
+	// been persisted for later.
+	StatusDroppedOverflow
+	// StatusDroppedSampled means the event was dropped by sampling.
+	StatusDroppedSampled
+	// StatusDroppedRateLimited means the event was dropped by rate limiting.
+	StatusDroppedRateLimited
+	// StatusDroppedCircuitOpen means the event was dropped because reporting
+	// is paused after repeated failures.
+	StatusDroppedCircuitOpen
+	// StatusDroppedDuplicate means the event was suppressed as a duplicate of
+	// a recently reported event.
+	StatusDroppedDuplicate
+	// StatusDroppedInvalid means the event was dropped because it failed
+	// validation, see ValidateEvent.
+	StatusDroppedInvalid
+	// StatusDroppedCanceled means the event was dropped because the caller's
+	// context was done before it could be enqueued.
+	StatusDroppedCanceled
+	// StatusDroppedIntercepted means the event was dropped by one of the
+	// configured interceptors.
+	StatusDroppedIntercepted
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusAccepted:
+		return "Accepted"
+	case StatusDroppedDisabled:
+		return "DroppedDisabled"
+	case StatusDroppedShuttingDown:
+		return "DroppedShuttingDown"
+	case StatusDroppedOverflow:
+		return "DroppedOverflow"
+	case StatusDroppedSampled:
+		return "DroppedSampled"
+	case StatusDroppedRateLimited:
+		return "DroppedRateLimited"
+	case StatusDroppedCircuitOpen:
+		return "DroppedCircuitOpen"
+	case StatusDroppedDuplicate:
+		return "DroppedDuplicate"
+	case StatusDroppedInvalid:
+		return "DroppedInvalid"
+	case StatusDroppedCanceled:
+		return "DroppedCanceled"
+	case StatusDroppedIntercepted:
+		return "DroppedIntercepted"
+	default:
+		return "Unknown"
+	}
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestReportEventResult(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: baseURL,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	r.SetEnabled(false)
+	require.Equal(t, telemetry.StatusDroppedDisabled, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+	r.SetEnabled(true)
+
+	// Fill up all the in-flight report slots.
+	for i := 0; i < 16; i++ {
+		require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+	}
+
+	require.Equal(t, telemetry.StatusDroppedOverflow, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+
+	close(svc.release)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Shutdown(ctx))
+
+	require.Equal(t, telemetry.StatusDroppedShuttingDown, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: "test"}))
+
+	stats := r.Stats()
+	require.Greater(t, stats.ReportRate, 0.0)
+	stats.ReportRate = 0
+
+	require.Equal(t, telemetry.Stats{
+		Accepted:            16,
+		DeliveredOK:         16,
+		DroppedOverflow:     1,
+		DroppedDisabled:     1,
+		DroppedShuttingDown: 1,
+		Reports:             16,
+	}, stats)
+}
+
+func TestCloseWithin(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	t.Run("Completes", func(t *testing.T) {
+		svc := newMockSvc()
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL: baseURL,
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.CloseWithin(5*time.Second))
+		require.Len(t, svc.receivedEvents, 1)
+
+		// Safe to close again.
+		require.NoError(t, r.Close())
+	})
+
+	t.Run("Aborts", func(t *testing.T) {
+		svc := &blockingSvc{mockSvc: newMockSvc(), release: make(chan struct{})}
+		t.Cleanup(func() {
+			close(svc.release)
+		})
+		baseURL := startServer(t, svc)
+
+		r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+			BaseURL: baseURL,
+		})
+
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+		start := time.Now()
+		require.NoError(t, r.CloseWithin(100*time.Millisecond))
+		require.Less(t, time.Since(start), 5*time.Second)
+		require.Empty(t, svc.receivedEvents)
+	})
+}
+
+// blockingSvc blocks all reports until released.
+type blockingSvc struct {
+	*mockSvc
+	release chan struct{}
+}
+
+func (s *blockingSvc) Report(ctx context.Context, req *connect.Request[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error) {
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return s.mockSvc.Report(ctx, req)
+}
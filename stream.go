@@ -0,0 +1,255 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1/v1alpha1connect"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	// The maximum number of events written to a stream before it's closed,
+	// confirming their receipt, and a new one opened.
+	maxStreamEvents = 1000
+	// The maximum amount of time a stream is kept open for.
+	maxStreamAge = time.Minute
+)
+
+// errStreamingUnsupported is returned when the server doesn't support
+// streaming, and events must be reported with unary requests instead.
+var errStreamingUnsupported = errors.New("streaming not supported by the server")
+
+// eventStream reports events over a long-lived client stream, reconnecting
+// on error. Events written to a stream are only known to have been received
+// once it's closed, so they're kept until then, and re-sent if it breaks.
+// Their outcome is passed to settle once known.
+type eventStream struct {
+	clock      Clock
+	client     v1alpha1connect.TelemetryClient
+	setHeaders func(ctx context.Context, header http.Header) error
+	settle     func(events []*v1alpha1.TelemetryEvent, err error)
+	// Canceled on abort, the parent of every stream's context.
+	ctx         context.Context
+	abort       context.CancelFunc
+	mu          sync.Mutex
+	stream      *connect.ClientStreamForClient[v1alpha1.TelemetryEvent, emptypb.Empty]
+	cancel      context.CancelFunc
+	opened      time.Time
+	unconfirmed []*v1alpha1.TelemetryEvent
+	unsupported bool
+}
+
+func newEventStream(clock Clock, client v1alpha1connect.TelemetryClient, setHeaders func(ctx context.Context, header http.Header) error, settle func(events []*v1alpha1.TelemetryEvent, err error)) *eventStream {
+	// The streams outlive the reports that open them.
+	ctx, abort := context.WithCancel(context.Background())
+
+	return &eventStream{
+		clock:      clock,
+		client:     client,
+		setHeaders: setHeaders,
+		settle:     settle,
+		ctx:        ctx,
+		abort:      abort,
+	}
+}
+
+// send writes events to the stream, opening a new one if needed, and
+// reconnecting once if it's broken. The outcome of written events is settled
+// once the stream is closed. If writing fails, the error is returned, and any
+// previously written events that are lost with it are settled as failed. If
+// the server doesn't support streaming, it returns errStreamingUnsupported
+// along with the events that must be reported by other means (previously
+// written events first, followed by the given events).
+func (s *eventStream) send(ctx context.Context, events []*v1alpha1.TelemetryEvent) ([]*v1alpha1.TelemetryEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.unsupported {
+		return events, errStreamingUnsupported
+	}
+
+	// Previously written events that need writing again.
+	var rewrite []*v1alpha1.TelemetryEvent
+
+	// Periodically close the stream, confirming the events written to it.
+	if s.stream != nil && (len(s.unconfirmed) >= maxStreamEvents || s.clock.Now().Sub(s.opened) >= maxStreamAge) {
+		rewrite, _ = s.closeLocked()
+	}
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.unsupported {
+			return append(rewrite, events...), errStreamingUnsupported
+		}
+
+		if err = s.writeLocked(ctx, append(rewrite, events...)); err == nil {
+			return nil, nil
+		}
+
+		// Failed to open the stream.
+		if s.stream == nil {
+			break
+		}
+
+		// The given events were written last.
+		var unconfirmed []*v1alpha1.TelemetryEvent
+		if unconfirmed, err = s.closeLocked(); err == nil {
+			return nil, nil
+		}
+		rewrite = unconfirmed[:len(unconfirmed)-len(events)]
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if s.unsupported {
+		return append(rewrite, events...), errStreamingUnsupported
+	}
+
+	s.settle(rewrite, err)
+
+	return nil, err
+}
+
+// close closes the stream (if open), settling the events written to it. If
+// the server doesn't support streaming, it returns errStreamingUnsupported
+// along with the events that must be reported by other means.
+func (s *eventStream) close() ([]*v1alpha1.TelemetryEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stream == nil {
+		return nil, nil
+	}
+
+	unconfirmed, err := s.closeLocked()
+	if s.unsupported {
+		return unconfirmed, errStreamingUnsupported
+	}
+
+	if err != nil {
+		s.settle(unconfirmed, err)
+	}
+
+	return nil, err
+}
+
+// writeLocked writes events to the stream, opening it if needed. The caller
+// must hold the lock.
+func (s *eventStream) writeLocked(ctx context.Context, events []*v1alpha1.TelemetryEvent) error {
+	if s.stream == nil {
+		streamCtx, cancel := context.WithCancel(s.ctx)
+		stream := s.client.StreamReport(streamCtx)
+		if err := s.setHeaders(ctx, stream.RequestHeader()); err != nil {
+			cancel()
+			return err
+		}
+
+		s.stream, s.cancel, s.opened = stream, cancel, s.clock.Now()
+	}
+
+	s.unconfirmed = append(s.unconfirmed, events...)
+	for _, event := range events {
+		if err := s.stream.Send(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// closeLocked closes the stream, settling the events written to it if it
+// succeeded, or otherwise returning the events that may not have been
+// received. The caller must hold the lock.
+func (s *eventStream) closeLocked() ([]*v1alpha1.TelemetryEvent, error) {
+	_, err := s.stream.CloseAndReceive()
+	s.cancel()
+
+	unconfirmed := s.unconfirmed
+	s.stream, s.cancel, s.unconfirmed = nil, nil, nil
+
+	if err != nil {
+		if connect.CodeOf(err) == connect.CodeUnimplemented {
+			s.unsupported = true
+		}
+
+		return unconfirmed, err
+	}
+
+	s.settle(unconfirmed, nil)
+
+	return nil, nil
+}
+
+// closeStreams closes any open streams, confirming the events written to
+// them. It returns an error if any of the events may not have been received.
+func (r *Reporter) closeStreams(ctx context.Context) error {
+	if r.streamingSink == nil {
+		return nil
+	}
+
+	return r.streamingSink.closeStreams(ctx)
+}
+
+// settleStreamed records the outcome of events written to a stream, once the
+// stream has been closed. Until then, their receipt isn't confirmed.
+func (r *Reporter) settleStreamed(events []*v1alpha1.TelemetryEvent, err error) {
+	if len(events) == 0 {
+		return
+	}
+
+	if r.audit != nil {
+		if auditErr := r.audit.record("", events, err); auditErr != nil {
+			r.logger.Warn("Failed to record audit log", slog.Any("error", auditErr))
+		}
+	}
+
+	if err == nil {
+		r.stats.deliveredOK.Add(uint64(len(events)))
+
+		if r.onSuccess != nil {
+			for _, event := range events {
+				r.onSuccess(event)
+			}
+		}
+
+		return
+	}
+
+	if isAuthError(err) {
+		err = &AuthError{Err: err}
+	}
+
+	r.logger.Log(context.Background(), r.failureLogLevel.Level(), "Failed to report streamed events",
+		slog.Int("events", len(events)), slog.Any("error", err))
+
+	r.stats.failedSend.Add(uint64(len(events)))
+
+	if r.onError != nil {
+		for _, event := range events {
+			r.onError(event, err)
+		}
+	}
+
+	// No point in trying again later if the server rejected the events.
+	if isRetryable(err) || r.reportsCtx.Err() != nil {
+		r.spoolEvents(events)
+	}
+}
@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/telemetrytest"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+func TestStreaming(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	srv := telemetrytest.NewServer(t)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:   srv.URL,
+		Streaming: true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for i := 0; i < 10; i++ {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	}
+	require.NoError(t, r.Flush(ctx))
+
+	require.Len(t, srv.Events(), 10)
+	// All of the events were sent over a single stream.
+	require.Equal(t, 1, srv.Requests())
+	// And confirmed once it was closed.
+	require.Equal(t, uint64(10), r.Stats().DeliveredOK)
+
+	// Flushing closed the stream, so a new one is opened.
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	require.NoError(t, r.Shutdown(ctx))
+
+	require.Len(t, srv.Events(), 11)
+	require.Equal(t, 2, srv.Requests())
+}
+
+func TestStreamingMaxAge(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	srv := telemetrytest.NewServer(t)
+	clock := telemetrytest.NewClock(time.Now())
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:   srv.URL,
+		Streaming: true,
+		Clock:     clock,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	_, err := srv.WaitForEvents(ctx, 1)
+	require.NoError(t, err)
+
+	// Still open, so the event isn't confirmed yet.
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	_, err = srv.WaitForEvents(ctx, 2)
+	require.NoError(t, err)
+	require.Equal(t, 1, srv.Requests())
+	require.Zero(t, r.Stats().DeliveredOK)
+
+	// Once it's too old, the stream is closed before writing the next event.
+	clock.Advance(time.Minute)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+	_, err = srv.WaitForEvents(ctx, 3)
+	require.NoError(t, err)
+	require.Equal(t, 2, srv.Requests())
+	require.Equal(t, uint64(2), r.Stats().DeliveredOK)
+}
+
+func TestStreamingRejected(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	srv := telemetrytest.NewServer(t)
+	srv.SetError(connect.NewError(connect.CodeInvalidArgument, errors.New("bad event")))
+
+	var successes, failures atomic.Int32
+	var auditLog lockedBuffer
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:   srv.URL,
+		Streaming: true,
+		AuditLog:  &auditLog,
+		OnSuccess: func(*v1alpha1.TelemetryEvent) {
+			successes.Add(1)
+		},
+		OnError: func(_ *v1alpha1.TelemetryEvent, err error) {
+			require.Equal(t, connect.CodeInvalidArgument, connect.CodeOf(err))
+			failures.Add(1)
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+
+	// Writing to the stream doesn't mean the server received the event.
+	require.Error(t, r.Flush(ctx))
+
+	require.Zero(t, successes.Load())
+	require.Equal(t, int32(1), failures.Load())
+
+	stats := r.Stats()
+	require.Zero(t, stats.DeliveredOK)
+	require.Equal(t, uint64(1), stats.FailedSend)
+	require.Empty(t, srv.Events())
+	require.Empty(t, auditLog.String())
+}
+
+func TestStreamingPing(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	srv := telemetrytest.NewServer(t)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:   srv.URL,
+		Streaming: true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.NoError(t, r.Ping(ctx))
+	require.Equal(t, 1, srv.Requests())
+
+	// The server is actually contacted.
+	r = telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:   "http://" + deadAddr(t),
+		Streaming: true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.Equal(t, connect.CodeUnavailable, connect.CodeOf(r.Ping(ctx)))
+}
+
+func TestStreamingUnsupported(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := &unaryOnlySvc{mockSvc: newMockSvc()}
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:   baseURL,
+		Streaming: true,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	for i := 0; i < 3; i++ {
+		r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "test"})
+		require.NoError(t, r.Flush(ctx))
+	}
+
+	// Falls back to unary requests.
+	for i := 0; i < 3; i++ {
+		select {
+		case ev := <-svc.receivedEvents:
+			require.Equal(t, "test", ev.Name)
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for event")
+		}
+	}
+
+	require.Zero(t, r.Stats().FailedSend)
+}
+
+// unaryOnlySvc doesn't support streaming.
+type unaryOnlySvc struct {
+	*mockSvc
+}
+
+func (s *unaryOnlySvc) StreamReport(ctx context.Context, stream *connect.ClientStream[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, nil)
+}
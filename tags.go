@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// reporterAttributes are the reporter level tags and labels. They're replaced
+// as a whole, so that each event sees a consistent snapshot.
+type reporterAttributes struct {
+	tags []string
+	// Including the metadata labels.
+	labels map[string]string
+}
+
+// SetTags replaces the reporter level tags (see Configuration.Tags) applied
+// to subsequently reported events, eg. when the active profile changes.
+// Events that have already been reported keep their tags.
+func (r *Reporter) SetTags(tags ...string) {
+	tags = slices.Clone(tags)
+
+	for {
+		current := r.attributes.Load()
+		if r.attributes.CompareAndSwap(current, &reporterAttributes{tags: tags, labels: current.labels}) {
+			return
+		}
+	}
+}
+
+// SetLabels replaces the reporter level labels (see Configuration.Labels)
+// applied to subsequently reported events. The application, library version,
+// and runtime metadata labels are kept. Events that have already been
+// reported keep their labels.
+func (r *Reporter) SetLabels(labels map[string]string) {
+	merged := r.withMetadata(labels)
+
+	for {
+		current := r.attributes.Load()
+		if r.attributes.CompareAndSwap(current, &reporterAttributes{tags: current.tags, labels: merged}) {
+			return
+		}
+	}
+}
+
+// withMetadata returns the configured labels merged with the metadata labels.
+func (r *Reporter) withMetadata(labels map[string]string) map[string]string {
+	merged := maps.Clone(labels)
+	if merged == nil {
+		merged = make(map[string]string, len(r.metadata))
+	}
+	maps.Copy(merged, r.metadata)
+
+	return merged
+}
+
+// tagFunc calls the configured tag function (see Configuration.TagFunc),
+// without letting a slow one hold up reporting. Only one call is in progress
+// at a time, and while it is, or if it times out, the tags from the last
+// completed call are used.
+type tagFunc struct {
+	logger  *slog.Logger
+	fn      func() []string
+	timeout time.Duration
+	mu      sync.Mutex
+	last    []string
+	// Closed when the call in progress returns, nil if there isn't one.
+	pending chan struct{}
+}
+
+func newTagFunc(logger *slog.Logger, fn func() []string, timeout time.Duration) *tagFunc {
+	return &tagFunc{
+		logger:  logger,
+		fn:      fn,
+		timeout: timeout,
+	}
+}
+
+// tags returns the current dynamic tags.
+func (t *tagFunc) tags() []string {
+	t.mu.Lock()
+	pending := t.pending
+	if pending == nil {
+		pending = make(chan struct{})
+		t.pending = pending
+		go t.call(pending)
+	}
+	t.mu.Unlock()
+
+	timer := time.NewTimer(t.timeout)
+	defer timer.Stop()
+
+	select {
+	case <-pending:
+	case <-timer.C:
+		t.logger.Debug("Timed out waiting for dynamic tags, using the last known tags")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.last
+}
+
+func (t *tagFunc) call(done chan struct{}) {
+	tags := t.fn()
+
+	t.mu.Lock()
+	t.last, t.pending = tags, nil
+	t.mu.Unlock()
+
+	close(done)
+}
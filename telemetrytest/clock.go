@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+// Package telemetrytest provides utilities for testing code that uses the
+// telemetry package.
+package telemetrytest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/noisysockets/telemetry"
+)
+
+// Clock is a fake clock that only moves when told to. Timers fire once the
+// clock is moved past their deadline.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers map[*timer]struct{}
+}
+
+// NewClock creates a new fake clock, set to the given time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now, timers: make(map[*timer]struct{})}
+}
+
+// Now returns the current time of the fake clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// AfterFunc calls f in its own goroutine once the fake clock has been moved
+// forward by at least the given duration.
+func (c *Clock) AfterFunc(d time.Duration, f func()) telemetry.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &timer{clock: c, when: c.now.Add(d), f: f}
+	if d <= 0 {
+		go f()
+		return t
+	}
+
+	c.timers[t] = struct{}{}
+
+	return t
+}
+
+// Set sets the current time of the fake clock.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	c.now = now
+	c.mu.Unlock()
+
+	c.fire()
+}
+
+// Advance moves the fake clock forward by the given duration.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+
+	c.fire()
+}
+
+// Timers returns the number of timers waiting to fire.
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+// fire calls the timers whose deadline has passed.
+func (c *Clock) fire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for t := range c.timers {
+		if !t.when.After(c.now) {
+			delete(c.timers, t)
+			go t.f()
+		}
+	}
+}
+
+type timer struct {
+	clock *Clock
+	when  time.Time
+	f     func()
+}
+
+func (t *timer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	_, ok := t.clock.timers[t]
+	delete(t.clock.timers, t)
+
+	return ok
+}
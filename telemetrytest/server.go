@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetrytest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1/v1alpha1connect"
+	"github.com/noisysockets/telemetry/internal/compress"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// Server is an in-process telemetry server, for integration tests of code
+// that reports telemetry, eg.
+//
+//	srv := telemetrytest.NewServer(t)
+//	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+//		BaseURL: srv.URL,
+//	})
+type Server struct {
+	// URL is the base URL of the server.
+	URL string
+
+	mu       sync.Mutex
+	events   []*v1alpha1.TelemetryEvent
+	requests int
+	err      error
+	// Closed (and replaced) whenever an event is received.
+	received chan struct{}
+}
+
+// NewServer starts a new telemetry server, it's closed when the test
+// finishes. It supports HTTP/2 over cleartext (h2c), so it can be used with
+// any protocol, and every compression algorithm.
+func NewServer(t testing.TB) *Server {
+	s := &Server{
+		received: make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(v1alpha1connect.NewTelemetryHandler(s,
+		connect.WithCompression(compress.Zstd, compress.NewZstdDecompressor, compress.NewZstdCompressor)))
+
+	srv := httptest.NewUnstartedServer(h2c.NewHandler(mux, &http2.Server{}))
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	s.URL = srv.URL
+
+	return s
+}
+
+// Events returns the events received so far, in the order they were received.
+func (s *Server) Events() []*v1alpha1.TelemetryEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make([]*v1alpha1.TelemetryEvent, len(s.events))
+	for i, event := range s.events {
+		events[i] = proto.Clone(event).(*v1alpha1.TelemetryEvent)
+	}
+
+	return events
+}
+
+// Requests returns the number of report requests received so far, including
+// failed requests (see SetError) and empty batches (eg. from Reporter.Ping).
+// A stream counts as a single request.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// WaitForEvents blocks until at least n events have been received, returning
+// them. It returns an error if ctx is done first.
+func (s *Server) WaitForEvents(ctx context.Context, n int) ([]*v1alpha1.TelemetryEvent, error) {
+	for {
+		s.mu.Lock()
+		count, received := len(s.events), s.received
+		s.mu.Unlock()
+
+		if count >= n {
+			return s.Events(), nil
+		}
+
+		select {
+		case <-received:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// SetError makes all subsequent reports fail with the given error, eg. a
+// *connect.Error with connect.CodeUnavailable to test retries. Pass nil to
+// accept reports again.
+func (s *Server) SetError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+// Reset discards the received events, and the count of requests.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = nil
+	s.requests = 0
+}
+
+// Report implements v1alpha1connect.TelemetryHandler.
+func (s *Server) Report(_ context.Context, req *connect.Request[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error) {
+	if err := s.receive(req.Msg); err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&emptypb.Empty{}), nil
+}
+
+// BatchReport implements v1alpha1connect.TelemetryHandler.
+func (s *Server) BatchReport(_ context.Context, req *connect.Request[v1alpha1.TelemetryEventBatch]) (*connect.Response[emptypb.Empty], error) {
+	if err := s.receive(req.Msg.Events...); err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&emptypb.Empty{}), nil
+}
+
+// StreamReport implements v1alpha1connect.TelemetryHandler.
+func (s *Server) StreamReport(_ context.Context, stream *connect.ClientStream[v1alpha1.TelemetryEvent]) (*connect.Response[emptypb.Empty], error) {
+	if err := s.request(); err != nil {
+		return nil, err
+	}
+
+	for stream.Receive() {
+		s.record(stream.Msg())
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&emptypb.Empty{}), nil
+}
+
+// receive records the events of a request, unless an error was injected.
+func (s *Server) receive(events ...*v1alpha1.TelemetryEvent) error {
+	if err := s.request(); err != nil {
+		return err
+	}
+
+	s.record(events...)
+
+	return nil
+}
+
+// request counts a request, returning the injected error (if any).
+func (s *Server) request() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests++
+
+	return s.err
+}
+
+// record records received events.
+func (s *Server) record(events ...*v1alpha1.TelemetryEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, events...)
+
+	close(s.received)
+	s.received = make(chan struct{})
+}
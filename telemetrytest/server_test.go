@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetrytest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/telemetrytest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	srv := telemetrytest.NewServer(t)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL: srv.URL,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "first"})
+	r.ReportEvent(&v1alpha1.TelemetryEvent{Name: "second"})
+
+	events, err := srv.WaitForEvents(ctx, 2)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"first", "second"}, []string{events[0].Name, events[1].Name})
+
+	t.Run("Injected Error", func(t *testing.T) {
+		srv.Reset()
+		srv.SetError(connect.NewError(connect.CodeUnavailable, errors.New("unavailable")))
+
+		require.Equal(t, connect.CodeUnavailable, connect.CodeOf(r.Ping(ctx)))
+		require.Equal(t, 1, srv.Requests())
+		require.Empty(t, srv.Events())
+
+		srv.SetError(nil)
+
+		require.NoError(t, r.Ping(ctx))
+		require.Equal(t, 2, srv.Requests())
+	})
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+)
+
+// The default maximum number of events buffered between throttled reports.
+const defaultThrottleBufferSize = 1000
+
+// throttler limits the rate of outbound reports, by buffering events and
+// coalescing them into a single report once per interval. When the buffer is
+// full the oldest events are dropped.
+type throttler struct {
+	size     int
+	interval time.Duration
+	flush    func(events []*v1alpha1.TelemetryEvent)
+	mu       sync.Mutex
+	events   []*v1alpha1.TelemetryEvent
+	flushes  chan chan struct{}
+	stopping chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+func newThrottler(ctx context.Context, size int, interval time.Duration, flush func(events []*v1alpha1.TelemetryEvent)) *throttler {
+	t := &throttler{
+		size:     size,
+		interval: interval,
+		flush:    flush,
+		flushes:  make(chan chan struct{}),
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go t.run(ctx)
+
+	return t
+}
+
+// add buffers events until the next report, returning the number of older
+// events that were dropped to make room for them.
+func (t *throttler) add(events []*v1alpha1.TelemetryEvent) (dropped []*v1alpha1.TelemetryEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.events = append(t.events, events...)
+	if excess := len(t.events) - t.size; excess > 0 {
+		dropped = t.events[:excess:excess]
+		t.events = t.events[excess:]
+	}
+
+	return dropped
+}
+
+// take removes and returns all the buffered events.
+func (t *throttler) take() []*v1alpha1.TelemetryEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	events := t.events
+	t.events = nil
+
+	return events
+}
+
+// flushBuffered reports any buffered events immediately, returning once
+// they've been handed off for reporting.
+func (t *throttler) flushBuffered(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case t.flushes <- flushed:
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stop reports any buffered events and waits for the throttler to exit.
+func (t *throttler) stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopping)
+	})
+
+	<-t.done
+}
+
+func (t *throttler) run(ctx context.Context) {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if events := t.take(); len(events) > 0 {
+			t.flush(events)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Aborted, discard any buffered events.
+			return
+		case <-t.stopping:
+			flush()
+			return
+		case flushed := <-t.flushes:
+			flush()
+			close(flushed)
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
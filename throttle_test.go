@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMinReportInterval(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:            baseURL,
+		MinReportInterval:  200 * time.Millisecond,
+		ThrottleBufferSize: 3,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{Name: name}))
+	}
+
+	// Nothing is sent until the interval has elapsed.
+	require.Empty(t, svc.receivedBatches)
+	require.Empty(t, svc.receivedEvents)
+
+	// The most recent events are coalesced into a single report.
+	select {
+	case batch := <-svc.receivedBatches:
+		var names []string
+		for _, ev := range batch.Events {
+			names = append(names, ev.Name)
+		}
+		require.Equal(t, []string{"c", "d", "e"}, names)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for report")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	require.NoError(t, r.Flush(ctx))
+
+	stats := r.Stats()
+	require.Equal(t, uint64(2), stats.DroppedOverflow)
+	require.Equal(t, uint64(1), stats.Reports)
+	require.Greater(t, stats.ReportRate, 0.0)
+}
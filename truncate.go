@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"unicode/utf8"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+)
+
+const (
+	// Appended to truncated tag and label values.
+	truncationMarker = "…"
+	// Tag and label values are never truncated to less than this many bytes.
+	minTruncatedLen = 32
+)
+
+// truncateEvent shrinks an oversized event to fit within maxBytes, by
+// truncating its largest tag and label values, returning true if anything was
+// truncated. The event may still not fit if its other fields are too large.
+func truncateEvent(event *v1alpha1.TelemetryEvent, maxBytes int) (truncated bool) {
+	for {
+		excess := eventSize(event) - maxBytes
+		if excess <= 0 {
+			return truncated
+		}
+
+		// Find the largest value that can still be truncated.
+		largestTag, largestLabel, largestLen := -1, -1, minTruncatedLen+len(truncationMarker)
+		for i, tag := range event.Tags {
+			if len(tag) > largestLen {
+				largestTag, largestLabel, largestLen = i, -1, len(tag)
+			}
+		}
+		for i, label := range event.Labels {
+			if len(label.Value) > largestLen {
+				largestTag, largestLabel, largestLen = -1, i, len(label.Value)
+			}
+		}
+
+		newLen := max(minTruncatedLen, largestLen-excess-len(truncationMarker))
+
+		switch {
+		case largestTag >= 0:
+			event.Tags[largestTag] = truncate(event.Tags[largestTag], newLen)
+		case largestLabel >= 0:
+			// Labels may be shared with other events, so replace rather
+			// than modify them.
+			label := event.Labels[largestLabel]
+			event.Labels[largestLabel] = &v1alpha1.Label{
+				Key:   label.Key,
+				Value: truncate(label.Value, newLen),
+			}
+		default:
+			return truncated
+		}
+
+		truncated = true
+	}
+}
+
+// truncate shortens s to at most n bytes (without splitting a character) and
+// appends the truncation marker.
+func truncate(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n] + truncationMarker
+}
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http2"
+)
+
+// The base URL used for requests sent over a Unix domain socket, when the
+// socket was given as a unix:// base URL.
+const unixSocketBaseURL = "http://localhost"
+
+// unixSocketPath returns the socket path if baseURL is a unix:// URL, eg.
+// "unix:///run/telemetry.sock".
+func unixSocketPath(baseURL string) (string, bool) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme != "unix" {
+		return "", false
+	}
+
+	return u.Path, true
+}
+
+// newUnixSocketTransport returns a transport that sends requests over the
+// Unix domain socket at path, using HTTP/2 over cleartext (h2c).
+func newUnixSocketTransport(path string, keepalive http2Keepalive) http.RoundTripper {
+	var dialer net.Dialer
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, _, _ string, _ *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}
+	keepalive.apply(transport)
+
+	return transport
+}
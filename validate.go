@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// DefaultMaxEventBytes is the default maximum serialized size of an event.
+	DefaultMaxEventBytes = 64 * 1024
+	// DefaultMaxTags is the default maximum number of tags on an event.
+	DefaultMaxTags = 64
+)
+
+// The encoded size of an event's sequence number (a two byte field tag, and a
+// fixed64).
+const sequenceBytes = 10
+
+// ErrInvalidEvent is returned when an event fails validation.
+var ErrInvalidEvent = errors.New("invalid event")
+
+// ValidateEvent checks that an event is well-formed and within the default
+// size limits, so that it won't be rejected by the server.
+func ValidateEvent(event *v1alpha1.TelemetryEvent) error {
+	return validateEvent(event, DefaultMaxEventBytes, DefaultMaxTags)
+}
+
+func validateEvent(event *v1alpha1.TelemetryEvent, maxEventBytes, maxTags int) error {
+	if event == nil {
+		return fmt.Errorf("%w: nil event", ErrInvalidEvent)
+	}
+
+	if event.Name == "" {
+		return fmt.Errorf("%w: missing name", ErrInvalidEvent)
+	}
+
+	if _, ok := v1alpha1.TelemetryEventKind_name[int32(event.Kind)]; !ok {
+		return fmt.Errorf("%w: unknown kind %d", ErrInvalidEvent, event.Kind)
+	}
+
+	if len(event.Tags) > maxTags {
+		return fmt.Errorf("%w: too many tags (%d > %d)", ErrInvalidEvent, len(event.Tags), maxTags)
+	}
+
+	for _, label := range event.Labels {
+		if label.GetKey() == "" {
+			return fmt.Errorf("%w: label with empty key", ErrInvalidEvent)
+		}
+	}
+
+	if size := eventSize(event); size > maxEventBytes {
+		return fmt.Errorf("%w: too large (%d > %d bytes)", ErrInvalidEvent, size, maxEventBytes)
+	}
+
+	return nil
+}
+
+// eventSize returns the serialized size of an event, including room for its
+// sequence number if it hasn't been assigned yet (as it's only assigned once
+// the event is accepted).
+func eventSize(event *v1alpha1.TelemetryEvent) int {
+	size := proto.Size(event)
+	if event.Sequence == 0 {
+		size += sequenceBytes
+	}
+
+	return size
+}
@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neilotoole/slogt"
+	"github.com/noisysockets/telemetry"
+	"github.com/noisysockets/telemetry/gen/telemetry/v1alpha1"
+	"github.com/noisysockets/telemetry/telemetrytest"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestValidateEvent(t *testing.T) {
+	require.NoError(t, telemetry.ValidateEvent(&v1alpha1.TelemetryEvent{
+		Kind: v1alpha1.TelemetryEventKind_INFO,
+		Name: "test",
+		Tags: []string{"foo", "bar"},
+	}))
+
+	require.ErrorIs(t, telemetry.ValidateEvent(nil), telemetry.ErrInvalidEvent)
+
+	require.ErrorIs(t, telemetry.ValidateEvent(&v1alpha1.TelemetryEvent{
+		Kind: v1alpha1.TelemetryEventKind_INFO,
+	}), telemetry.ErrInvalidEvent)
+
+	require.ErrorIs(t, telemetry.ValidateEvent(&v1alpha1.TelemetryEvent{
+		Name: "test",
+		Kind: v1alpha1.TelemetryEventKind(100),
+	}), telemetry.ErrInvalidEvent)
+
+	tags := make([]string, telemetry.DefaultMaxTags+1)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("tag-%d", i)
+	}
+	require.ErrorIs(t, telemetry.ValidateEvent(&v1alpha1.TelemetryEvent{
+		Name: "test",
+		Tags: tags,
+	}), telemetry.ErrInvalidEvent)
+
+	require.ErrorIs(t, telemetry.ValidateEvent(&v1alpha1.TelemetryEvent{
+		Name:   "test",
+		Labels: []*v1alpha1.Label{{Value: "foo"}},
+	}), telemetry.ErrInvalidEvent)
+
+	require.ErrorIs(t, telemetry.ValidateEvent(&v1alpha1.TelemetryEvent{
+		Name:    "test",
+		Message: strings.Repeat("a", telemetry.DefaultMaxEventBytes),
+	}), telemetry.ErrInvalidEvent)
+}
+
+func TestReportInvalidEvent(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:       baseURL,
+		Tags:          []string{"foo"},
+		MaxEventBytes: 128,
+		MaxTags:       2,
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(&v1alpha1.TelemetryEvent{
+		Name: "test",
+		Tags: []string{"bar"},
+	}))
+
+	// Too many tags once the reporter tags are added.
+	require.Equal(t, telemetry.StatusDroppedInvalid, r.ReportEventResult(&v1alpha1.TelemetryEvent{
+		Name: "test",
+		Tags: []string{"bar", "baz"},
+	}))
+
+	require.Equal(t, telemetry.StatusDroppedInvalid, r.ReportEventResult(&v1alpha1.TelemetryEvent{
+		Name:    "test",
+		Message: strings.Repeat("a", 128),
+	}))
+
+	require.Equal(t, telemetry.StatusDroppedInvalid, r.ReportEventResult(&v1alpha1.TelemetryEvent{
+		Tags: []string{"bar"},
+	}))
+
+	require.Equal(t, telemetry.StatusDroppedInvalid, r.ReportEventResult(nil))
+	require.Equal(t, telemetry.StatusDroppedInvalid, r.ReportEventImportant(nil))
+
+	require.NoError(t, r.Flush(ctx))
+
+	stats := r.Stats()
+	require.Equal(t, uint64(1), stats.Accepted)
+	require.Equal(t, uint64(5), stats.DroppedInvalid)
+}
+
+func TestTruncateOversizedEvent(t *testing.T) {
+	ctx := context.Background()
+	logger := slogt.New(t)
+
+	svc := newMockSvc()
+	baseURL := startServer(t, svc)
+
+	const maxEventBytes = 1024
+
+	errs := make(chan error, 10)
+
+	r := telemetry.NewReporter(ctx, logger, telemetry.Configuration{
+		BaseURL:       baseURL,
+		MaxEventBytes: maxEventBytes,
+		// Keep the size of the stamped fields constant.
+		Clock:              telemetrytest.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+		OmitLibraryVersion: true,
+		OnError: func(_ *v1alpha1.TelemetryEvent, err error) {
+			errs <- err
+		},
+	})
+	t.Cleanup(func() {
+		require.NoError(t, r.Close())
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	t.Cleanup(cancel)
+
+	eventWithTag := func(n int) *v1alpha1.TelemetryEvent {
+		return &v1alpha1.TelemetryEvent{
+			Name: "test",
+			Tags: []string{"small", strings.Repeat("a", n)},
+			Labels: []*v1alpha1.Label{
+				{Key: "stack", Value: strings.Repeat("b", 200)},
+			},
+		}
+	}
+
+	// Work out the size of the tag that fills the event exactly.
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(eventWithTag(500)))
+	require.NoError(t, r.Flush(ctx))
+	tagLen := 500 + maxEventBytes - proto.Size(<-svc.receivedEvents)
+
+	// Just under the limit.
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(eventWithTag(tagLen)))
+	require.NoError(t, r.Flush(ctx))
+
+	ev := <-svc.receivedEvents
+	require.Equal(t, maxEventBytes, proto.Size(ev))
+	require.Len(t, ev.Tags[1], tagLen)
+
+	// Just over the limit, the largest value is truncated.
+	require.Equal(t, telemetry.StatusAccepted, r.ReportEventResult(eventWithTag(tagLen+1)))
+	require.NoError(t, r.Flush(ctx))
+
+	ev = <-svc.receivedEvents
+	require.LessOrEqual(t, proto.Size(ev), maxEventBytes)
+	require.True(t, strings.HasSuffix(ev.Tags[1], "…"))
+	require.Equal(t, "small", ev.Tags[0])
+	require.Equal(t, strings.Repeat("b", 200), ev.Labels[0].Value)
+
+	// Events that can't be truncated enough are dropped.
+	require.Equal(t, telemetry.StatusDroppedInvalid, r.ReportEventResult(&v1alpha1.TelemetryEvent{
+		Name:    "test",
+		Message: strings.Repeat("a", maxEventBytes),
+	}))
+	require.ErrorIs(t, <-errs, telemetry.ErrInvalidEvent)
+}
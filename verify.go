@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// The default maximum amount of time to wait when verifying the telemetry
+// server is reachable on start.
+const defaultVerifyTimeout = 5 * time.Second
+
+// NewReporterWithVerify creates a new telemetry reporter, like NewReporter,
+// but returns an error if VerifyOnStart is set and the telemetry server
+// couldn't be reached. The reporter is closed on failure.
+func NewReporterWithVerify(ctx context.Context, logger *slog.Logger, conf Configuration) (*Reporter, error) {
+	r := newReporter(ctx, logger, conf)
+
+	if conf.VerifyOnStart {
+		if err := r.verify(ctx, conf.VerifyTimeout); err != nil {
+			_ = r.Close()
+			return nil, fmt.Errorf("failed to verify telemetry server: %w", err)
+		}
+	}
+
+	return r, nil
+}
+
+// verify pings the telemetry server, waiting at most timeout. It's skipped if
+// telemetry is disabled, so that opting out never results in network calls.
+func (r *Reporter) verify(ctx context.Context, timeout time.Duration) error {
+	if !r.Enabled() {
+		return nil
+	}
+
+	if timeout <= 0 {
+		timeout = defaultVerifyTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return r.Ping(ctx)
+}
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: MPL-2.0
+/*
+ * Copyright (C) 2024 The Noisy Sockets Authors.
+ *
+ * This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/.
+ */
+
+package telemetry
+
+import (
+	"log/slog"
+	"runtime/debug"
+	"sync"
+)
+
+const modulePath = "github.com/noisysockets/telemetry"
+
+// Reserved labels used to record version metadata.
+const (
+	appNameLabelKey    = "app_name"
+	appVersionLabelKey = "app_version"
+	versionLabelKey    = "telemetry_version"
+)
+
+// DefaultSchemaVersion is the version of the event schema spoken by this
+// library, see Configuration.SchemaVersion.
+const DefaultSchemaVersion = "v1alpha1"
+
+// The header used to send the schema version with each report.
+const schemaVersionHeader = "X-Telemetry-Schema-Version"
+
+// libraryVersion returns the version of this module, as recorded in the
+// build info of the running binary.
+var libraryVersion = sync.OnceValue(func() string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+
+	if bi.Main.Path == modulePath && bi.Main.Version != "" {
+		return bi.Main.Version
+	}
+
+	for _, dep := range bi.Deps {
+		if dep.Path == modulePath {
+			if dep.Replace != nil && dep.Replace.Version != "" {
+				return dep.Replace.Version
+			}
+
+			return dep.Version
+		}
+	}
+
+	return "devel"
+})
+
+// defaultUserAgent returns the default User-Agent header value.
+func defaultUserAgent() string {
+	return "noisysockets-telemetry/" + libraryVersion()
+}
+
+// metadataLabels returns the application and library version metadata
+// labels, along with runtime information if enabled, and the geo hint. They're
+// computed once, when the reporter is created, and take precedence over the
+// configured labels.
+func metadataLabels(logger *slog.Logger, conf Configuration) map[string]string {
+	labels := make(map[string]string, 8)
+	if conf.GeoHint != "" {
+		labels[geoLabelKey] = conf.GeoHint
+	}
+
+	if conf.IncludeRuntimeInfo {
+		for key, value := range runtimeLabels() {
+			labels[key] = value
+		}
+	}
+
+	// Added by the library itself, so never identify the host's network.
+	labels = labelsWithoutIPs(logger, labels)
+
+	if conf.AppName != "" {
+		labels[appNameLabelKey] = conf.AppName
+	}
+
+	if conf.AppVersion != "" {
+		labels[appVersionLabelKey] = conf.AppVersion
+	}
+
+	if !conf.OmitLibraryVersion {
+		labels[versionLabelKey] = libraryVersion()
+	}
+
+	return labels
+}